@@ -1,5 +1,7 @@
 package ast
 
+import "github.com/tympanix/gocalc/scanner/token"
+
 // Type denotes the result type of an AST node
 type Type int
 
@@ -7,8 +9,47 @@ const (
 	UNKNOWN Type = iota
 	INTEGER
 	FLOAT
+	RATIONAL
+	COMPLEX
+	BOOLEAN
 )
 
+// String returns the name of the type
+func (t Type) String() string {
+	switch t {
+	case INTEGER:
+		return "INTEGER"
+	case FLOAT:
+		return "FLOAT"
+	case RATIONAL:
+		return "RATIONAL"
+	case COMPLEX:
+		return "COMPLEX"
+	case BOOLEAN:
+		return "BOOLEAN"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// numeric reports whether values of the type are numbers. The UNKNOWN type
+// is assumed to be numeric.
+func numeric(t Type) bool {
+	return t != BOOLEAN
+}
+
+// whole reports whether values of the type are integers. The UNKNOWN type
+// is assumed to be an integer.
+func whole(t Type) bool {
+	return t == INTEGER || t == UNKNOWN
+}
+
+// boolean reports whether values of the type are booleans. The UNKNOWN type
+// is assumed to be a boolean.
+func boolean(t Type) bool {
+	return t == BOOLEAN || t == UNKNOWN
+}
+
 // IntType is a embeddable helper struct for integer types
 type IntType struct{}
 
@@ -29,8 +70,10 @@ func (f FloatType) Type() Type {
 type Node interface {
 	Analyze() error
 	Type() Type
-	Calc() float64
+	Calc(env *Env) (Value, error)
 	Print()
+	Span() token.Span
+	SetSpan(token.Span)
 }
 
 // NopAnalyzer is an analyzer for nodes which do not require analysis
@@ -40,3 +83,18 @@ type NopAnalyzer struct{}
 func (n NopAnalyzer) Analyze() error {
 	return nil
 }
+
+// Location is an embeddable helper struct for nodes located in the source
+type Location struct {
+	span token.Span
+}
+
+// Span returns the location of the node in the source
+func (l *Location) Span() token.Span {
+	return l.span
+}
+
+// SetSpan sets the location of the node in the source
+func (l *Location) SetSpan(span token.Span) {
+	l.span = span
+}
@@ -0,0 +1,496 @@
+package ast
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// guardBits is the number of extra bits used for intermediate results of
+// functions computed with arbitrary precision
+const guardBits = 64
+
+// hiddenDigits is the number of digits of the precision of a float which
+// are not shown, as they hold the rounding errors of the last bits
+const hiddenDigits = 2
+
+// maxTextExp bounds the binary exponent of floats which are converted to
+// decimal exactly. The exact conversion of larger exponents is slow.
+const maxTextExp = 4096
+
+// BigFloat is a value of type FLOAT with arbitrary precision. It must not be
+// modified.
+type BigFloat struct {
+	*big.Float
+}
+
+// Type returns the float type
+func (f BigFloat) Type() Type {
+	return FLOAT
+}
+
+// String returns the decimal representation with as many significant
+// digits as the precision of the float holds, except for the last digits
+// which may hold rounding errors
+func (f BigFloat) String() string {
+	digits := int(float64(f.Prec())*math.Log10(2)) - hiddenDigits
+	if digits < 1 {
+		digits = 1
+	}
+	if exp := f.MantExp(nil); f.IsInf() || exp > -maxTextExp && exp < maxTextExp {
+		return f.Text('g', digits)
+	}
+	return scientific(f.Float, digits)
+}
+
+// scientific returns the float in scientific notation with the given number
+// of significant digits. The float is scaled by a power of ten close to it
+// first, such that the decimal conversion is fast.
+func scientific(x *big.Float, digits int) string {
+	w := x.Prec() + guardBits
+	d := int64(math.Floor(float64(x.MantExp(nil)) * math.Log10(2)))
+	p := newFloat(w)
+	powBigFloat(p, newFloat(w).SetInt64(10), newFloat(w).SetInt64(-d))
+	s := newFloat(w).Mul(x, p).Text('e', digits-1)
+	i := strings.LastIndexByte(s, 'e')
+	e, _ := strconv.ParseInt(s[i+1:], 10, 64)
+	mant := s[:i]
+	if strings.Contains(mant, ".") {
+		mant = strings.TrimRight(strings.TrimRight(mant, "0"), ".")
+	}
+	return fmt.Sprintf("%se%+03d", mant, e+d)
+}
+
+// bigFloatOp is an operation on arbitrary precision floats, storing the
+// result in z with the precision of z. It reports false if the operands are
+// outside the domain of the operation.
+type bigFloatOp func(z, x, y *big.Float) bool
+
+// bigFloatFunc is a function computed with the precision of its arguments.
+// It reports false if the arguments are outside the domain of the function.
+type bigFloatFunc func(env *Env, args []*big.Float) (*big.Float, bool)
+
+func newFloat(prec uint) *big.Float {
+	return new(big.Float).SetPrec(prec)
+}
+
+// toBigFloat returns the value as a float with the given precision. It
+// reports false if the value is not a finite number.
+func toBigFloat(v Value, prec uint) (*big.Float, bool) {
+	z := newFloat(prec)
+	switch v := v.(type) {
+	case Float:
+		if !finite(float64(v)) {
+			return nil, false
+		}
+		return z.SetFloat64(float64(v)), true
+	case Int:
+		return z.SetInt64(int64(v)), true
+	case Uint:
+		return z.SetUint64(uint64(v)), true
+	case BigInt:
+		return z.SetInt(v.Int), true
+	case BigFloat:
+		return z.Set(v.Float), true
+	case Rat:
+		return z.SetRat(v.Rat), true
+	}
+	return nil, false
+}
+
+// bigFloats returns the values as floats with the given precision. It
+// reports false if a value is not a finite number.
+func bigFloats(prec uint, values ...Value) ([]*big.Float, bool) {
+	args := make([]*big.Float, len(values))
+	for i, v := range values {
+		f, ok := toBigFloat(v, prec)
+		if !ok {
+			return nil, false
+		}
+		args[i] = f
+	}
+	return args, true
+}
+
+// callBig calls fn, reporting false if the computation produced NaN
+func callBig(fn func() (*big.Float, bool)) (r *big.Float, ok bool) {
+	defer func() {
+		if e := recover(); e != nil {
+			if _, nan := e.(big.ErrNaN); !nan {
+				panic(e)
+			}
+			r, ok = nil, false
+		}
+	}()
+	return fn()
+}
+
+// bigConst is a constant computed with arbitrary precision. The most
+// precise value computed so far is cached.
+type bigConst struct {
+	mu sync.Mutex
+	f  *big.Float
+	fn func(prec uint) *big.Float
+}
+
+func (c *bigConst) get(prec uint) *big.Float {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.f == nil || c.f.Prec() < prec+guardBits {
+		c.f = c.fn(prec + guardBits)
+	}
+	return newFloat(prec).Set(c.f)
+}
+
+var (
+	bigPi = &bigConst{fn: func(prec uint) *big.Float {
+		// Machin's formula: pi = 16 atan(1/5) - 4 atan(1/239)
+		a := atanSeries(newFloat(prec).Quo(big.NewFloat(1), big.NewFloat(5)))
+		b := atanSeries(newFloat(prec).Quo(big.NewFloat(1), big.NewFloat(239)))
+		a.Mul(a, big.NewFloat(16))
+		b.Mul(b, big.NewFloat(4))
+		return a.Sub(a, b)
+	}}
+	bigLn2 = &bigConst{fn: func(prec uint) *big.Float {
+		// ln 2 = 2 atanh(1/3)
+		t := atanhSeries(newFloat(prec).Quo(big.NewFloat(1), big.NewFloat(3)))
+		return t.Mul(t, big.NewFloat(2))
+	}}
+	bigLn10 = &bigConst{fn: func(prec uint) *big.Float {
+		r, _ := lnBig(newFloat(prec).SetInt64(10))
+		return r
+	}}
+	bigE = &bigConst{fn: func(prec uint) *big.Float {
+		return expBig(newFloat(prec).SetInt64(1))
+	}}
+)
+
+// converged reports whether the term no longer contributes to the sum at
+// the precision of the sum
+func converged(term, sum *big.Float) bool {
+	return term.Sign() == 0 || sum.Sign() != 0 && term.MantExp(nil) < sum.MantExp(nil)-int(sum.Prec())
+}
+
+// atanSeries computes atan(x) for small x by its Taylor series
+func atanSeries(x *big.Float) *big.Float {
+	prec := x.Prec()
+	x2 := newFloat(prec).Mul(x, x)
+	pow := newFloat(prec).Set(x)
+	sum := newFloat(prec).Set(x)
+	term := newFloat(prec)
+	for k := int64(1); ; k++ {
+		pow.Mul(pow, x2)
+		pow.Neg(pow)
+		term.Quo(pow, newFloat(prec).SetInt64(2*k+1))
+		if converged(term, sum) {
+			return sum
+		}
+		sum.Add(sum, term)
+	}
+}
+
+// atanhSeries computes atanh(x) for small x by its Taylor series
+func atanhSeries(x *big.Float) *big.Float {
+	prec := x.Prec()
+	x2 := newFloat(prec).Mul(x, x)
+	pow := newFloat(prec).Set(x)
+	sum := newFloat(prec).Set(x)
+	term := newFloat(prec)
+	for k := int64(1); ; k++ {
+		pow.Mul(pow, x2)
+		term.Quo(pow, newFloat(prec).SetInt64(2*k+1))
+		if converged(term, sum) {
+			return sum
+		}
+		sum.Add(sum, term)
+	}
+}
+
+// expBig computes e^x with the precision of x. The result is infinite if
+// it is too large to be represented.
+func expBig(x *big.Float) *big.Float {
+	prec := x.Prec()
+	if x.Sign() == 0 {
+		return newFloat(prec).SetInt64(1)
+	}
+	// x = k ln 2 + r with |r| <= ln(2)/2, such that e^x = 2^k e^r. The
+	// series of e^r converges faster for r/2^s, which is squared s times.
+	const s = 16
+	w := prec + guardBits + s
+	ln2 := bigLn2.get(w)
+	q, _ := newFloat(w).Quo(x, ln2).Float64()
+	if math.Abs(q) > 1<<30 {
+		if q < 0 {
+			return newFloat(prec)
+		}
+		return newFloat(prec).SetInf(false)
+	}
+	k := math.Round(q)
+	r := newFloat(w).Mul(ln2, newFloat(w).SetFloat64(k))
+	r.Sub(newFloat(w).Set(x), r)
+	r.SetMantExp(r, -s)
+
+	sum := newFloat(w).SetInt64(1)
+	term := newFloat(w).SetInt64(1)
+	for n := int64(1); ; n++ {
+		term.Mul(term, r)
+		term.Quo(term, newFloat(w).SetInt64(n))
+		if converged(term, sum) {
+			break
+		}
+		sum.Add(sum, term)
+	}
+	for i := 0; i < s; i++ {
+		sum.Mul(sum, sum)
+	}
+	sum.SetMantExp(sum, int(k))
+	return newFloat(prec).Set(sum)
+}
+
+// lnBig computes the natural logarithm of x with the precision of x. It
+// reports false if x is not positive.
+func lnBig(x *big.Float) (*big.Float, bool) {
+	prec := x.Prec()
+	if x.Sign() <= 0 {
+		return nil, false
+	}
+	// x = m 2^e with 0.5 <= m < 1, such that ln x = ln m + e ln 2, and
+	// ln m = 2 atanh((m-1)/(m+1))
+	w := prec + guardBits
+	m := newFloat(w)
+	e := x.MantExp(m)
+	t := newFloat(w).Sub(m, big.NewFloat(1))
+	t.Quo(t, newFloat(w).Add(m, big.NewFloat(1)))
+	r := atanhSeries(t)
+	r.Mul(r, big.NewFloat(2))
+	r.Add(r, newFloat(w).Mul(bigLn2.get(w), newFloat(w).SetInt64(int64(e))))
+	return newFloat(prec).Set(r), true
+}
+
+// log2Big computes the binary logarithm of x, which is exact for powers
+// of two
+func log2Big(x *big.Float) (*big.Float, bool) {
+	m := new(big.Float)
+	e := x.MantExp(m)
+	if x.Sign() > 0 && m.Cmp(big.NewFloat(0.5)) == 0 {
+		return newFloat(x.Prec()).SetInt64(int64(e - 1)), true
+	}
+	return logBaseBig(x, bigLn2)
+}
+
+// logBaseBig computes the logarithm of x in the base of the given natural
+// logarithm
+func logBaseBig(x *big.Float, lnBase *bigConst) (*big.Float, bool) {
+	w := x.Prec() + guardBits
+	r, ok := lnBig(newFloat(w).Set(x))
+	if !ok {
+		return nil, false
+	}
+	r.Quo(r, lnBase.get(w))
+	return newFloat(x.Prec()).Set(r), true
+}
+
+// powBigFloat computes x^y with the precision of z. Integer exponents are
+// computed by repeated squaring, such that negative bases are allowed.
+func powBigFloat(z, x, y *big.Float) bool {
+	prec := z.Prec()
+	w := prec + guardBits
+	if n, acc := y.Int64(); y.IsInt() && acc == big.Exact {
+		if y.Sign() < 0 && x.Sign() == 0 {
+			return false
+		}
+		r := newFloat(w).SetInt64(1)
+		b := newFloat(w).Set(x)
+		for e := absInt64(n); e > 0; e >>= 1 {
+			if e&1 == 1 {
+				r.Mul(r, b)
+			}
+			b.Mul(b, b)
+		}
+		if n < 0 {
+			r.Quo(newFloat(w).SetInt64(1), r)
+		}
+		z.Set(r)
+		return true
+	}
+	if x.Sign() < 0 {
+		return false
+	}
+	if x.Sign() == 0 {
+		z.SetInt64(0)
+		return y.Sign() > 0
+	}
+	l, _ := lnBig(newFloat(w).Set(x))
+	l.Mul(l, y)
+	z.Set(expBig(l))
+	return true
+}
+
+func absInt64(n int64) uint64 {
+	if n < 0 {
+		return uint64(-(n + 1)) + 1
+	}
+	return uint64(n)
+}
+
+// sinCosBig computes the sine and cosine of x with the precision of x
+func sinCosBig(x *big.Float) (sin, cos *big.Float) {
+	prec := x.Prec()
+	w := prec + guardBits
+	if e := x.MantExp(nil); e > 0 {
+		w += uint(e)
+	}
+	// reduce x to r in [-pi, pi]
+	twoPi := bigPi.get(w)
+	twoPi.Mul(twoPi, big.NewFloat(2))
+	k := newFloat(w).Quo(x, twoPi)
+	k.Add(k, big.NewFloat(0.5))
+	n, _ := k.Int(nil)
+	if k.Sign() < 0 && !k.IsInt() {
+		n.Sub(n, big.NewInt(1))
+	}
+	r := newFloat(w).Mul(twoPi, newFloat(w).SetInt(n))
+	r.Sub(newFloat(w).Set(x), r)
+
+	r2 := newFloat(w).Mul(r, r)
+	s := newFloat(w).Set(r)
+	c := newFloat(w).SetInt64(1)
+	st := newFloat(w).Set(r)
+	ct := newFloat(w).SetInt64(1)
+	for k := int64(1); !converged(st, s) || !converged(ct, c); k++ {
+		st.Mul(st, r2)
+		st.Quo(st, newFloat(w).SetInt64(-(2*k)*(2*k+1)))
+		ct.Mul(ct, r2)
+		ct.Quo(ct, newFloat(w).SetInt64(-(2*k-1)*(2*k)))
+		s.Add(s, st)
+		c.Add(c, ct)
+	}
+	return newFloat(prec).Set(s), newFloat(prec).Set(c)
+}
+
+// atanBig computes the arc tangent of x with the precision of x
+func atanBig(x *big.Float) *big.Float {
+	prec := x.Prec()
+	w := prec + guardBits
+	a := newFloat(w).Abs(x)
+	invert := a.Cmp(big.NewFloat(1)) > 0
+	if invert {
+		a.Quo(newFloat(w).SetInt64(1), a)
+	}
+	// atan(a) = 2 atan(a / (1 + sqrt(1 + a^2))), which is repeated until
+	// the series converges quickly
+	doublings := 0
+	for a.Cmp(big.NewFloat(0.125)) > 0 {
+		d := newFloat(w).Mul(a, a)
+		d.Add(d, big.NewFloat(1))
+		d.Sqrt(d)
+		d.Add(d, big.NewFloat(1))
+		a.Quo(a, d)
+		doublings++
+	}
+	r := atanSeries(a)
+	r.SetMantExp(r, doublings)
+	if invert {
+		halfPi := bigPi.get(w)
+		halfPi.SetMantExp(halfPi, -1)
+		r.Sub(halfPi, r)
+	}
+	if x.Sign() < 0 {
+		r.Neg(r)
+	}
+	return newFloat(prec).Set(r)
+}
+
+// asinBig computes the arc sine of x with the precision of x. It reports
+// false if x is outside [-1, 1].
+func asinBig(x *big.Float) (*big.Float, bool) {
+	prec := x.Prec()
+	w := prec + guardBits
+	switch newFloat(w).Abs(x).Cmp(big.NewFloat(1)) {
+	case 1:
+		return nil, false
+	case 0:
+		halfPi := bigPi.get(prec)
+		halfPi.SetMantExp(halfPi, -1)
+		if x.Sign() < 0 {
+			halfPi.Neg(halfPi)
+		}
+		return halfPi, true
+	}
+	// asin(x) = atan(x / sqrt(1 - x^2))
+	d := newFloat(w).Mul(x, x)
+	d.Sub(big.NewFloat(1), d)
+	d.Sqrt(d)
+	r := atanBig(d.Quo(newFloat(w).Set(x), d))
+	return newFloat(prec).Set(r), true
+}
+
+// acosBig computes the arc cosine of x with the precision of x. It reports
+// false if x is outside [-1, 1].
+func acosBig(x *big.Float) (*big.Float, bool) {
+	w := x.Prec() + guardBits
+	r, ok := asinBig(newFloat(w).Set(x))
+	if !ok {
+		return nil, false
+	}
+	halfPi := bigPi.get(w)
+	halfPi.SetMantExp(halfPi, -1)
+	return newFloat(x.Prec()).Sub(halfPi, r), true
+}
+
+// floorBig rounds x down to an integer
+func floorBig(x *big.Float) *big.Float {
+	if x.IsInt() {
+		return x
+	}
+	i, _ := x.Int(nil)
+	if x.Sign() < 0 {
+		i.Sub(i, big.NewInt(1))
+	}
+	return newFloat(x.Prec()).SetInt(i)
+}
+
+// ceilBig rounds x up to an integer
+func ceilBig(x *big.Float) *big.Float {
+	if x.IsInt() {
+		return x
+	}
+	i, _ := x.Int(nil)
+	if x.Sign() > 0 {
+		i.Add(i, big.NewInt(1))
+	}
+	return newFloat(x.Prec()).SetInt(i)
+}
+
+// roundBig rounds x to the nearest integer, rounding half away from zero
+func roundBig(x *big.Float) *big.Float {
+	if x.IsInt() {
+		return x
+	}
+	h := newFloat(x.Prec() + guardBits).Abs(x)
+	h.Add(h, big.NewFloat(0.5))
+	i, _ := h.Int(nil)
+	if x.Sign() < 0 {
+		i.Neg(i)
+	}
+	return newFloat(x.Prec()).SetInt(i)
+}
+
+// degreesBig converts the angle x from radians to degrees
+func degreesBig(x *big.Float) *big.Float {
+	w := x.Prec() + guardBits
+	r := newFloat(w).Mul(x, big.NewFloat(180))
+	r.Quo(r, bigPi.get(w))
+	return newFloat(x.Prec()).Set(r)
+}
+
+// radiansBig converts the angle x from degrees to radians
+func radiansBig(x *big.Float) *big.Float {
+	w := x.Prec() + guardBits
+	r := newFloat(w).Mul(x, bigPi.get(w))
+	r.Quo(r, big.NewFloat(180))
+	return newFloat(x.Prec()).Set(r)
+}
@@ -0,0 +1,150 @@
+package ast
+
+import "math/big"
+
+// maxBigIntBits limits the size of arbitrary precision integers, such that
+// an evaluation can not exhaust the memory
+const maxBigIntBits = 1 << 20
+
+// IntegerMode denotes the precision of INTEGER arithmetic
+type IntegerMode int
+
+const (
+	// FixedIntegers computes integers in 64 bits. Results which do not fit
+	// are reported as overflow.
+	FixedIntegers IntegerMode = iota
+	// BigIntegers computes integers in 64 bits while they fit, and promotes
+	// them to arbitrary precision on overflow
+	BigIntegers
+)
+
+// BigInt is a value of type INTEGER which is too large to be an Int or Uint.
+// It must not be modified.
+type BigInt struct {
+	*big.Int
+}
+
+// Type returns the integer type
+func (b BigInt) Type() Type {
+	return INTEGER
+}
+
+// bigOp is an operation on arbitrary precision integers, storing the
+// result in z. It reports false if the result is not an integer.
+type bigOp func(z, x, y *big.Int) bool
+
+// toBig returns the integer value with arbitrary precision
+func toBig(v Value) (*big.Int, bool) {
+	switch v := v.(type) {
+	case Int:
+		return big.NewInt(int64(v)), true
+	case Uint:
+		return new(big.Int).SetUint64(uint64(v)), true
+	case BigInt:
+		return v.Int, true
+	}
+	return nil, false
+}
+
+// fromBig returns the integer as an Int or Uint if it fits in 64 bits, and
+// as a BigInt otherwise. It reports false if the integer exceeds the size
+// limit of arbitrary precision integers.
+func fromBig(x *big.Int) (Value, bool) {
+	switch {
+	case x.IsInt64():
+		return Int(x.Int64()), true
+	case x.IsUint64():
+		return Uint(x.Uint64()), true
+	case x.BitLen() > maxBigIntBits:
+		return nil, false
+	}
+	return BigInt{x}, true
+}
+
+func addBig(z, x, y *big.Int) bool {
+	z.Add(x, y)
+	return true
+}
+
+func subBig(z, x, y *big.Int) bool {
+	z.Sub(x, y)
+	return true
+}
+
+func mulBig(z, x, y *big.Int) bool {
+	z.Mul(x, y)
+	return true
+}
+
+// powBig computes the power, unless the result would exceed the size limit
+// of arbitrary precision integers, in which case z is set to the limit
+func powBig(z, x, y *big.Int) bool {
+	if y.Sign() < 0 {
+		return false
+	}
+	if x.CmpAbs(big.NewInt(1)) > 0 && (!y.IsInt64() || int64(x.BitLen()-1)*y.Int64() > maxBigIntBits) {
+		z.Lsh(big.NewInt(1), maxBigIntBits)
+		return true
+	}
+	z.Exp(x, y, nil)
+	return true
+}
+
+// modBig computes the remainder truncated towards zero, like the %
+// operator of Go
+func modBig(z, x, y *big.Int) bool {
+	z.Rem(x, y)
+	return true
+}
+
+func andBig(z, x, y *big.Int) bool {
+	z.And(x, y)
+	return true
+}
+
+func orBig(z, x, y *big.Int) bool {
+	z.Or(x, y)
+	return true
+}
+
+func xorBig(z, x, y *big.Int) bool {
+	z.Xor(x, y)
+	return true
+}
+
+// shlBig shifts to the left, unless the result would exceed the size limit
+// of arbitrary precision integers, in which case z is set to the limit
+func shlBig(z, x, y *big.Int) bool {
+	if y.Sign() < 0 {
+		return false
+	}
+	if x.Sign() != 0 && (!y.IsInt64() || int64(x.BitLen())+y.Int64() > maxBigIntBits) {
+		z.Lsh(big.NewInt(1), maxBigIntBits)
+		return true
+	}
+	z.Lsh(x, uint(y.Int64()))
+	return true
+}
+
+// shrBig shifts to the right arithmetically, rounding towards negative
+// infinity
+func shrBig(z, x, y *big.Int) bool {
+	if y.Sign() < 0 {
+		return false
+	}
+	n := uint(maxBigIntBits + 1)
+	if y.IsInt64() && y.Int64() < int64(n) {
+		n = uint(y.Int64())
+	}
+	z.Rsh(x, n)
+	return true
+}
+
+// ushrBig shifts to the right, filling in zeros. Negative integers beyond 64
+// bits have no two's complement bit pattern of fixed width.
+func ushrBig(z, x, y *big.Int) bool {
+	if x.Sign() < 0 {
+		return false
+	}
+	return shrBig(z, x, y)
+}
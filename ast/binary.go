@@ -1,45 +1,93 @@
 package ast
 
 import (
-	"fmt"
 	"math"
+	"math/big"
 
 	"github.com/tympanix/gocalc/debug"
+	"github.com/tympanix/gocalc/diag"
 )
 
+// maxShift bounds the shift count of floats, beyond which every float is
+// shifted to zero or infinity
+const maxShift = 2048
+
 type binaryAnalyzer func(*binaryExp) error
 
 var defaultBinaryAnalyzer = func(b *binaryExp) error {
-	if err := b.LHS().Analyze(); err != nil {
-		return err
-	}
-	if err := b.RHS().Analyze(); err != nil {
-		return err
+	var errs diag.List
+	errs.Append(b.LHS().Analyze())
+	errs.Append(b.RHS().Analyze())
+	if !numeric(b.LHS().Type()) || !numeric(b.RHS().Type()) {
+		errs.Add(b.Span(), &TypeError{
+			Kind:     IllegalOperands,
+			Span:     b.Span(),
+			Name:     b.name,
+			Operands: []Type{b.LHS().Type(), b.RHS().Type()},
+		})
 	}
-	return nil
+	return errs.Err()
 }
 
 var integerBinaryAnalyzer = func(b *binaryExp) error {
-	if err := defaultBinaryAnalyzer(b); err != nil {
-		return err
-	}
-	if b.LHS().Type() != INTEGER || b.RHS().Type() != INTEGER {
-		return fmt.Errorf("illegal operands for: %s", b.name)
+	var errs diag.List
+	errs.Append(b.LHS().Analyze())
+	errs.Append(b.RHS().Analyze())
+	if !whole(b.LHS().Type()) || !whole(b.RHS().Type()) {
+		errs.Add(b.Span(), &TypeError{
+			Kind:     IllegalOperands,
+			Span:     b.Span(),
+			Name:     b.name,
+			Operands: []Type{b.LHS().Type(), b.RHS().Type()},
+		})
 	}
-	return nil
-
+	return errs.Err()
 }
 
 type binaryTyper func(b *binaryExp) Type
 
 var defaultBinaryTyper = func(b *binaryExp) Type {
-	if b.LHS().Type() == INTEGER && b.RHS().Type() == INTEGER {
+	l, r := b.LHS().Type(), b.RHS().Type()
+	switch {
+	case l == UNKNOWN || r == UNKNOWN:
+		return UNKNOWN
+	case l == INTEGER && r == INTEGER:
 		return INTEGER
+	case exact(l) && exact(r):
+		return RATIONAL
+	case l == COMPLEX || r == COMPLEX:
+		return COMPLEX
 	}
 	return FLOAT
 }
 
-var floatBinaryTyper = func(b *binaryExp) Type {
+// quotientBinaryTyper types the quotient of exact operands as RATIONAL
+var quotientBinaryTyper = func(b *binaryExp) Type {
+	l, r := b.LHS().Type(), b.RHS().Type()
+	switch {
+	case l == UNKNOWN || r == UNKNOWN:
+		return UNKNOWN
+	case exact(l) && exact(r):
+		return RATIONAL
+	case l == COMPLEX || r == COMPLEX:
+		return COMPLEX
+	}
+	return FLOAT
+}
+
+// powBinaryTyper types the power of an exact base and an integer exponent
+// as the type of the base. The power of an integer with a negative exponent
+// is rational, which the integer operators reject during evaluation.
+var powBinaryTyper = func(b *binaryExp) Type {
+	l, r := b.LHS().Type(), b.RHS().Type()
+	switch {
+	case l == UNKNOWN || r == UNKNOWN:
+		return UNKNOWN
+	case exact(l) && r == INTEGER:
+		return l
+	case l == COMPLEX || r == COMPLEX:
+		return COMPLEX
+	}
 	return FLOAT
 }
 
@@ -54,6 +102,26 @@ type binaryExp struct {
 	a    binaryAnalyzer
 	t    binaryTyper
 	fn   func(float64, float64) float64
+	// ints and bigs compute the operation exactly if both operands are
+	// integers, in 64 bits and with arbitrary precision respectively
+	ints intOp
+	bigs bigOp
+	// rats computes the operation exactly if both operands are rational
+	rats ratOp
+	// bigf computes the operation with arbitrary precision if enabled by
+	// the environment
+	bigf bigFloatOp
+	// cmplx computes the operation if either operand is complex, or if the
+	// environment enables complex results for real operands
+	cmplx complexOp
+	// divides is set if the right-hand side must not be zero
+	divides bool
+	// pole reports whether real operands are a pole of the operation, at
+	// which it is a division by zero
+	pole func(x, y float64) bool
+	// integral is set if the operands must be integers
+	integral bool
+	Location
 }
 
 // Analyse performs analysis on the right- and lef-hand side
@@ -74,8 +142,163 @@ func (b *binaryExp) Type() Type {
 	return b.t(b)
 }
 
-func (b *binaryExp) Calc() float64 {
-	return b.fn(b.LHS().Calc(), b.RHS().Calc())
+func (b *binaryExp) Calc(env *Env) (Value, error) {
+	lhs, err := b.LHS().Calc(env)
+	if err != nil {
+		return nil, err
+	}
+	rhs, err := b.RHS().Calc(env)
+	if err != nil {
+		return nil, err
+	}
+	if x, y := ToFloat(lhs), ToFloat(rhs); b.pole != nil && !hasComplex(lhs, rhs) && b.pole(x, y) {
+		return env.fail(b, DivisionByZero, b.name, b.fn(x, y))
+	}
+	if b.integral {
+		var lok, rok bool
+		lhs, lok = toIntegral(lhs)
+		rhs, rok = toIntegral(rhs)
+		if !lok || !rok {
+			return env.fail(b, DomainError, b.name, math.NaN())
+		}
+	}
+	if v, ok, err := b.calcInt(env, lhs, rhs); ok {
+		return v, err
+	}
+	if lhs.Type() == RATIONAL || rhs.Type() == RATIONAL || b.ints == nil {
+		if v, ok, err := b.calcRat(env, lhs, rhs); ok {
+			return v, err
+		}
+	}
+	if hasComplex(lhs, rhs) && b.cmplx != nil {
+		return b.calcComplex(env, lhs, rhs)
+	}
+	if v, ok, err := b.calcBigFloat(env, lhs, rhs); ok {
+		return v, err
+	}
+	x, y := ToFloat(lhs), ToFloat(rhs)
+	r := b.fn(x, y)
+	if b.divides && y == 0 {
+		return env.fail(b, DivisionByZero, b.name, r)
+	}
+	if math.IsNaN(r) && finite(x, y) && env.Complex && b.cmplx != nil {
+		return b.calcComplex(env, lhs, rhs)
+	}
+	return env.float(b, b.name, r, x, y)
+}
+
+// calcComplex computes the operation on complex numbers
+func (b *binaryExp) calcComplex(env *Env, lhs, rhs Value) (Value, error) {
+	x, _ := toComplex(lhs)
+	y, _ := toComplex(rhs)
+	if b.divides && y == 0 && !env.IEEE {
+		return nil, &RuntimeError{Kind: DivisionByZero, Span: b.Span(), Name: b.name}
+	}
+	return env.complexResult(b, b.name, b.cmplx(x, y))
+}
+
+// calcInt computes the operation on integer operands, promoting them to
+// arbitrary precision on overflow if enabled by the environment. Results
+// which are not integers are computed as rational numbers. It reports false
+// if the operation must be computed otherwise, which is the case if an
+// operand is not an integer, or if the result overflows in IEEE mode.
+func (b *binaryExp) calcInt(env *Env, lhs, rhs Value) (Value, bool, error) {
+	if b.ints == nil || lhs.Type() != INTEGER || rhs.Type() != INTEGER {
+		return nil, false, nil
+	}
+	x, xok := toInteger(lhs)
+	y, yok := toInteger(rhs)
+	if b.divides && yok && y.mag == 0 {
+		if env.IEEE {
+			return nil, false, nil
+		}
+		return nil, true, &RuntimeError{Kind: DivisionByZero, Span: b.Span(), Name: b.name}
+	}
+	if xok && yok {
+		r, exact := b.ints(x, y)
+		if !exact {
+			return b.calcRat(env, lhs, rhs)
+		}
+		if v, ok := r.value(); ok {
+			return v, true, nil
+		}
+	}
+	if env.Integers == BigIntegers {
+		bx, _ := toBig(lhs)
+		by, _ := toBig(rhs)
+		z := new(big.Int)
+		if !b.bigs(z, bx, by) {
+			return b.calcRat(env, lhs, rhs)
+		}
+		if v, ok := fromBig(z); ok {
+			return v, true, nil
+		}
+	}
+	if env.IEEE {
+		return nil, false, nil
+	}
+	return nil, true, &RuntimeError{Kind: Overflow, Span: b.Span(), Name: b.name}
+}
+
+// calcRat computes the operation on rational operands, which includes
+// integers. It reports false if the operation must be computed with floats
+// instead, which is the case if an operand is not rational, if the result is
+// not rational, or for errors in IEEE mode.
+func (b *binaryExp) calcRat(env *Env, lhs, rhs Value) (Value, bool, error) {
+	if b.rats == nil {
+		return nil, false, nil
+	}
+	x, ok := toRat(lhs)
+	if !ok {
+		return nil, false, nil
+	}
+	y, ok := toRat(rhs)
+	if !ok {
+		return nil, false, nil
+	}
+	if b.divides && y.Sign() == 0 {
+		if env.IEEE {
+			return nil, false, nil
+		}
+		return nil, true, &RuntimeError{Kind: DivisionByZero, Span: b.Span(), Name: b.name}
+	}
+	z := new(big.Rat)
+	if !b.rats(z, x, y) || env.IEEE && ratBits(z) > maxBigIntBits {
+		return nil, false, nil
+	}
+	if ratBits(z) > maxBigIntBits {
+		return nil, true, &RuntimeError{Kind: Overflow, Span: b.Span(), Name: b.name}
+	}
+	return Rat{z}, true, nil
+}
+
+// calcBigFloat computes the operation with the precision of the
+// environment. It reports false if the operation must be computed with
+// floats instead, which is the case if arbitrary precision is disabled, if
+// an operand is not finite, or for errors in IEEE mode.
+func (b *binaryExp) calcBigFloat(env *Env, lhs, rhs Value) (Value, bool, error) {
+	if env.Precision == 0 || b.bigf == nil {
+		return nil, false, nil
+	}
+	args, ok := bigFloats(env.Precision, lhs, rhs)
+	if !ok {
+		return nil, false, nil
+	}
+	if b.divides && args[1].Sign() == 0 {
+		if env.IEEE {
+			return nil, false, nil
+		}
+		return nil, true, &RuntimeError{Kind: DivisionByZero, Span: b.Span(), Name: b.name}
+	}
+	r, ok := callBig(func() (*big.Float, bool) {
+		z := newFloat(env.Precision)
+		return z, b.bigf(z, args[0], args[1])
+	})
+	if !ok && env.Complex && b.cmplx != nil {
+		v, err := b.calcComplex(env, lhs, rhs)
+		return v, true, err
+	}
+	return env.bigFloat(b, b.name, r, ok)
 }
 
 func (b *binaryExp) LHS() Node {
@@ -97,6 +320,19 @@ func NewPlusOp(lhs Node, rhs Node) Node {
 		fn: func(a float64, b float64) float64 {
 			return a + b
 		},
+		ints: addInt,
+		bigs: addBig,
+		rats: func(z, x, y *big.Rat) bool {
+			z.Add(x, y)
+			return true
+		},
+		bigf: func(z, x, y *big.Float) bool {
+			z.Add(x, y)
+			return true
+		},
+		cmplx: func(x, y complex128) complex128 {
+			return x + y
+		},
 	}
 }
 
@@ -111,6 +347,19 @@ func NewMinusOp(lhs Node, rhs Node) Node {
 		fn: func(a float64, b float64) float64 {
 			return a - b
 		},
+		ints: subInt,
+		bigs: subBig,
+		rats: func(z, x, y *big.Rat) bool {
+			z.Sub(x, y)
+			return true
+		},
+		bigf: func(z, x, y *big.Float) bool {
+			z.Sub(x, y)
+			return true
+		},
+		cmplx: func(x, y complex128) complex128 {
+			return x - y
+		},
 	}
 }
 
@@ -125,20 +374,46 @@ func NewMulOp(lhs Node, rhs Node) Node {
 		fn: func(a float64, b float64) float64 {
 			return a * b
 		},
+		ints: mulInt,
+		bigs: mulBig,
+		rats: func(z, x, y *big.Rat) bool {
+			z.Mul(x, y)
+			return true
+		},
+		bigf: func(z, x, y *big.Float) bool {
+			z.Mul(x, y)
+			return true
+		},
+		cmplx: func(x, y complex128) complex128 {
+			return x * y
+		},
 	}
 }
 
-// NewDivOp returns a new AST node for the div operator
+// NewDivOp returns a new AST node for the div operator. The quotient of
+// integers is an exact rational number.
 func NewDivOp(lhs Node, rhs Node) Node {
 	return &binaryExp{
 		name: "/",
 		lhs:  lhs,
 		rhs:  rhs,
 		a:    defaultBinaryAnalyzer,
-		t:    floatBinaryTyper,
+		t:    quotientBinaryTyper,
 		fn: func(a float64, b float64) float64 {
 			return a / b
 		},
+		rats: func(z, x, y *big.Rat) bool {
+			z.Quo(x, y)
+			return true
+		},
+		bigf: func(z, x, y *big.Float) bool {
+			z.Quo(x, y)
+			return true
+		},
+		cmplx: func(x, y complex128) complex128 {
+			return x / y
+		},
+		divides: true,
 	}
 }
 
@@ -149,65 +424,159 @@ func NewPowOp(lhs Node, rhs Node) Node {
 		lhs:  lhs,
 		rhs:  rhs,
 		a:    defaultBinaryAnalyzer,
-		t:    defaultBinaryTyper,
+		t:    powBinaryTyper,
 		fn: func(a float64, b float64) float64 {
 			return math.Pow(a, b)
 		},
+		ints:  powInt,
+		bigs:  powBig,
+		rats:  powRat,
+		bigf:  powBigFloat,
+		cmplx: powComplex,
+		pole: func(a float64, b float64) bool {
+			return a == 0 && b < 0
+		},
 	}
 }
 
 // NewBitwiseAndOp returns the AST node for bitwise and (&) operator
 func NewBitwiseAndOp(lhs Node, rhs Node) Node {
 	return &binaryExp{
-		name: "&",
-		lhs:  lhs,
-		rhs:  rhs,
-		a:    integerBinaryAnalyzer,
-		t:    integerBinaryTyper,
+		name:     "&",
+		lhs:      lhs,
+		rhs:      rhs,
+		a:        integerBinaryAnalyzer,
+		integral: true,
+		t:        integerBinaryTyper,
 		fn: func(a float64, b float64) float64 {
 			return float64(int64(a) & int64(b))
 		},
+		ints: bitwise(func(a, b uint64) uint64 {
+			return a & b
+		}),
+		bigs: andBig,
 	}
 }
 
 // NewBitwiseOrOp returns the AST node for bitwise or (|) operator
 func NewBitwiseOrOp(lhs Node, rhs Node) Node {
 	return &binaryExp{
-		name: "|",
-		lhs:  lhs,
-		rhs:  rhs,
-		a:    integerBinaryAnalyzer,
-		t:    integerBinaryTyper,
+		name:     "|",
+		lhs:      lhs,
+		rhs:      rhs,
+		a:        integerBinaryAnalyzer,
+		integral: true,
+		t:        integerBinaryTyper,
 		fn: func(a float64, b float64) float64 {
 			return float64(int64(a) | int64(b))
 		},
+		ints: bitwise(func(a, b uint64) uint64 {
+			return a | b
+		}),
+		bigs: orBig,
 	}
 }
 
 // NewBitwiseXorOp returns the AST node for bitwise or (|) operator
 func NewBitwiseXorOp(lhs Node, rhs Node) Node {
 	return &binaryExp{
-		name: "#",
-		lhs:  lhs,
-		rhs:  rhs,
-		a:    integerBinaryAnalyzer,
-		t:    integerBinaryTyper,
+		name:     "#",
+		lhs:      lhs,
+		rhs:      rhs,
+		a:        integerBinaryAnalyzer,
+		integral: true,
+		t:        integerBinaryTyper,
 		fn: func(a float64, b float64) float64 {
 			return float64(int64(a) ^ int64(b))
 		},
+		ints: bitwise(func(a, b uint64) uint64 {
+			return a ^ b
+		}),
+		bigs: xorBig,
+	}
+}
+
+// NewShiftLeftOp returns the AST node for the left shift (<<) operator, which
+// multiplies by a power of two
+func NewShiftLeftOp(lhs Node, rhs Node) Node {
+	return &binaryExp{
+		name:     "<<",
+		lhs:      lhs,
+		rhs:      rhs,
+		a:        integerBinaryAnalyzer,
+		integral: true,
+		t:        integerBinaryTyper,
+		fn: func(a float64, b float64) float64 {
+			if b < 0 {
+				return math.NaN()
+			}
+			return math.Ldexp(a, int(math.Min(b, maxShift)))
+		},
+		ints: shlInt,
+		bigs: shlBig,
+	}
+}
+
+// NewShiftRightOp returns the AST node for the arithmetic right shift (>>)
+// operator, which divides by a power of two rounding towards negative
+// infinity
+func NewShiftRightOp(lhs Node, rhs Node) Node {
+	return &binaryExp{
+		name:     ">>",
+		lhs:      lhs,
+		rhs:      rhs,
+		a:        integerBinaryAnalyzer,
+		integral: true,
+		t:        integerBinaryTyper,
+		fn: func(a float64, b float64) float64 {
+			if b < 0 {
+				return math.NaN()
+			}
+			return math.Floor(math.Ldexp(a, -int(math.Min(b, maxShift))))
+		},
+		ints: shrInt,
+		bigs: shrBig,
+	}
+}
+
+// NewUnsignedShiftRightOp returns the AST node for the unsigned right shift
+// (>>>) operator, which shifts the 64-bit two's complement bit pattern
+func NewUnsignedShiftRightOp(lhs Node, rhs Node) Node {
+	return &binaryExp{
+		name:     ">>>",
+		lhs:      lhs,
+		rhs:      rhs,
+		a:        integerBinaryAnalyzer,
+		integral: true,
+		t:        integerBinaryTyper,
+		fn: func(a float64, b float64) float64 {
+			if b < 0 || a < math.MinInt64 || a >= 1<<64 {
+				return math.NaN()
+			}
+			if a < 0 {
+				return float64(uint64(int64(a)) >> uint64(math.Min(b, 64)))
+			}
+			return float64(uint64(a) >> uint64(math.Min(b, 64)))
+		},
+		ints: ushrInt,
+		bigs: ushrBig,
 	}
 }
 
 // NewModOp returns the AST node for mod (%) operator
 func NewModOp(lhs Node, rhs Node) Node {
 	return &binaryExp{
-		name: "%",
-		lhs:  lhs,
-		rhs:  rhs,
-		a:    integerBinaryAnalyzer,
-		t:    integerBinaryTyper,
+		name:     "%",
+		lhs:      lhs,
+		rhs:      rhs,
+		a:        integerBinaryAnalyzer,
+		integral: true,
+		t:        integerBinaryTyper,
 		fn: func(a float64, b float64) float64 {
-			return float64(int64(a) % int64(b))
+			return math.Mod(math.Trunc(a), math.Trunc(b))
 		},
+		ints:    modInt,
+		bigs:    modBig,
+		divides: true,
 	}
 }
@@ -0,0 +1,78 @@
+package ast
+
+// clone returns a copy of the tree rooted at n, in which references to the
+// variables in vars are replaced by their substitutes. Leaves without
+// variables are shared, since they are not changed by the analysis.
+func clone(n Node, vars map[*Variable]*Variable) Node {
+	switch e := n.(type) {
+	case *variableExp:
+		c := *e
+		if v, ok := vars[e.v]; ok {
+			c.v = v
+		}
+		return &c
+	case *assignExp:
+		c := *e
+		if v, ok := vars[e.v]; ok {
+			c.v = v
+		}
+		c.exp = clone(e.exp, vars)
+		return &c
+	case *binaryExp:
+		c := *e
+		c.lhs, c.rhs = clone(e.lhs, vars), clone(e.rhs, vars)
+		return &c
+	case *compareExp:
+		c := *e
+		c.lhs, c.rhs = clone(e.lhs, vars), clone(e.rhs, vars)
+		return &c
+	case *logicalExp:
+		c := *e
+		c.lhs, c.rhs = clone(e.lhs, vars), clone(e.rhs, vars)
+		return &c
+	case *unaryExp:
+		c := *e
+		c.param = clone(e.param, vars)
+		return &c
+	case *notExp:
+		c := *e
+		c.param = clone(e.param, vars)
+		return &c
+	case *condExp:
+		c := *e
+		c.cond = clone(e.cond, vars)
+		c.then, c.els = clone(e.then, vars), clone(e.els, vars)
+		return &c
+	case *piecewiseExp:
+		c := *e
+		c.params = cloneAll(e.params, vars)
+		return &c
+	case *funcExp:
+		c := *e
+		c.params = cloneAll(e.params, vars)
+		return &c
+	case *nativeExp:
+		c := *e
+		c.params = cloneAll(e.params, vars)
+		return &c
+	case *factorialExp:
+		c := *e
+		c.params = cloneAll(e.params, vars)
+		return &c
+	case *callExp:
+		c := *e
+		c.params = cloneAll(e.params, vars)
+		c.inst = nil
+		return &c
+	}
+	return n
+}
+
+// cloneAll returns copies of the trees in nodes
+func cloneAll(nodes []Node, vars map[*Variable]*Variable) []Node {
+	c := make([]Node, len(nodes))
+	for i, n := range nodes {
+		c[i] = clone(n, vars)
+	}
+	return c
+}
@@ -0,0 +1,90 @@
+package ast
+
+import (
+	"math"
+	"math/cmplx"
+	"strconv"
+	"strings"
+)
+
+// ComplexFormat denotes the textual representation of complex numbers
+type ComplexFormat int
+
+const (
+	// Rectangular shows complex numbers by their real and imaginary parts,
+	// e.g. 1+2i
+	Rectangular ComplexFormat = iota
+	// Polar shows complex numbers by their absolute value and argument in
+	// radians, e.g. 2∠1.5707963267948966
+	Polar
+)
+
+// Complex is a value of type COMPLEX
+type Complex complex128
+
+// Type returns the complex type
+func (c Complex) Type() Type {
+	return COMPLEX
+}
+
+// String returns the complex number in rectangular form
+func (c Complex) String() string {
+	return c.Text(Rectangular)
+}
+
+// Text returns the complex number in the given format
+func (c Complex) Text(f ComplexFormat) string {
+	if f == Polar {
+		r, theta := cmplx.Polar(complex128(c))
+		return Float(r).String() + "∠" + Float(theta).String()
+	}
+	s := strconv.FormatComplex(complex128(c), 'g', -1, 128)
+	return strings.TrimSuffix(strings.TrimPrefix(s, "("), ")")
+}
+
+// toComplex returns the value as a complex number
+func toComplex(v Value) (complex128, bool) {
+	if c, ok := v.(Complex); ok {
+		return complex128(c), true
+	}
+	if v == nil {
+		return 0, false
+	}
+	return complex(ToFloat(v), 0), true
+}
+
+// complexOp is an operation on complex numbers
+type complexOp func(x, y complex128) complex128
+
+// complexFunc is a function of complex numbers
+type complexFunc func(env *Env, args []complex128) complex128
+
+// hasComplex reports whether any of the values is complex
+func hasComplex(values ...Value) bool {
+	for _, v := range values {
+		if _, ok := v.(Complex); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// powComplex returns x**y. Integer exponents are computed by repeated
+// multiplication, such that e.g. i**2 is exactly -1.
+func powComplex(x, y complex128) complex128 {
+	n := real(y)
+	if imag(y) != 0 || n != math.Trunc(n) || math.Abs(n) > 1<<16 {
+		return cmplx.Pow(x, y)
+	}
+	r, k := complex(1, 0), int64(math.Abs(n))
+	for ; k > 0; k >>= 1 {
+		if k&1 == 1 {
+			r *= x
+		}
+		x *= x
+	}
+	if n < 0 {
+		return 1 / r
+	}
+	return r
+}
@@ -0,0 +1,248 @@
+package ast
+
+import (
+	"github.com/tympanix/gocalc/debug"
+	"github.com/tympanix/gocalc/diag"
+)
+
+// unify returns the common type of the branches of a conditional, promoting
+// numbers like the operands of arithmetic operators. It reports false if
+// the types can not be unified.
+func unify(types ...Type) (Type, bool) {
+	t := types[0]
+	for _, u := range types[1:] {
+		switch {
+		case t == u || u == UNKNOWN:
+			continue
+		case t == UNKNOWN:
+			t = u
+		case !numeric(t) || !numeric(u):
+			return UNKNOWN, false
+		case t == COMPLEX || u == COMPLEX:
+			t = COMPLEX
+		case exact(t) && exact(u):
+			t = RATIONAL
+		default:
+			t = FLOAT
+		}
+	}
+	return t, true
+}
+
+// promote converts the value of a branch to the common type of the branches
+func promote(env *Env, v Value, t Type) Value {
+	if v.Type() == t {
+		return v
+	}
+	switch t {
+	case RATIONAL:
+		if r, ok := toRat(v); ok {
+			return Rat{r}
+		}
+	case FLOAT:
+		if x, ok := toBigFloat(v, env.Precision); ok && env.Precision > 0 {
+			return BigFloat{x}
+		}
+		return Float(ToFloat(v))
+	case COMPLEX:
+		if c, ok := toComplex(v); ok {
+			return Complex(c)
+		}
+	}
+	return v
+}
+
+type condExp struct {
+	cond Node
+	then Node
+	els  Node
+	Location
+}
+
+// Analyze checks that the condition is a boolean and that the types of the
+// branches can be unified
+func (c *condExp) Analyze() error {
+	var errs diag.List
+	errs.Append(c.cond.Analyze())
+	errs.Append(c.then.Analyze())
+	errs.Append(c.els.Analyze())
+	if !boolean(c.cond.Type()) {
+		errs.Add(c.cond.Span(), &TypeError{
+			Kind:     IllegalArgument,
+			Span:     c.cond.Span(),
+			Name:     "if",
+			Operands: []Type{c.cond.Type()},
+			Arg:      1,
+		})
+	}
+	if _, ok := unify(c.then.Type(), c.els.Type()); !ok {
+		errs.Add(c.Span(), &TypeError{
+			Kind:     IllegalOperands,
+			Span:     c.Span(),
+			Name:     "if",
+			Operands: []Type{c.then.Type(), c.els.Type()},
+		})
+	}
+	return errs.Err()
+}
+
+// Type returns the common type of the branches
+func (c *condExp) Type() Type {
+	t, _ := unify(c.then.Type(), c.els.Type())
+	return t
+}
+
+// Calc evaluates the branch selected by the condition only
+func (c *condExp) Calc(env *Env) (Value, error) {
+	v, err := c.cond.Calc(env)
+	if err != nil {
+		return nil, err
+	}
+	branch := c.els
+	if b, _ := v.(Bool); b {
+		branch = c.then
+	}
+	r, err := branch.Calc(env)
+	if err != nil {
+		return nil, err
+	}
+	return promote(env, r, c.Type()), nil
+}
+
+func (c *condExp) Print() {
+	debug.Println("if")
+	debug.Indent()
+	c.cond.Print()
+	c.then.Print()
+	c.els.Print()
+	debug.Outdent()
+}
+
+// NewCondExp returns the AST node for a conditional expression, which
+// evaluates to then if cond holds and to els otherwise
+func NewCondExp(cond, then, els Node) Node {
+	return &condExp{cond: cond, then: then, els: els}
+}
+
+type piecewiseExp struct {
+	params []Node
+	Location
+}
+
+// branches returns the number of pairs of conditions and values
+func (p *piecewiseExp) branches() int {
+	return len(p.params) / 2
+}
+
+// fallback returns the value of the piecewise function if no condition
+// holds, or nil if there is none
+func (p *piecewiseExp) fallback() Node {
+	if len(p.params)%2 == 1 {
+		return p.params[len(p.params)-1]
+	}
+	return nil
+}
+
+// types returns the types of the values of the branches and the fallback
+func (p *piecewiseExp) types() []Type {
+	var types []Type
+	for i := 0; i < p.branches(); i++ {
+		types = append(types, p.params[2*i+1].Type())
+	}
+	if f := p.fallback(); f != nil {
+		types = append(types, f.Type())
+	}
+	return types
+}
+
+// Analyze checks that every condition is a boolean and that the types of the
+// values can be unified
+func (p *piecewiseExp) Analyze() error {
+	var errs diag.List
+	for _, n := range p.params {
+		errs.Append(n.Analyze())
+	}
+	if len(p.params) < 2 {
+		errs.Add(p.Span(), &TypeError{
+			Kind:     WrongArity,
+			Span:     p.Span(),
+			Name:     "piecewise",
+			Expected: 2,
+			Got:      len(p.params),
+			AtLeast:  true,
+		})
+		return errs.Err()
+	}
+	for i := 0; i < p.branches(); i++ {
+		if n := p.params[2*i]; !boolean(n.Type()) {
+			errs.Add(n.Span(), &TypeError{
+				Kind:     IllegalArgument,
+				Span:     n.Span(),
+				Name:     "piecewise",
+				Operands: []Type{n.Type()},
+				Arg:      2*i + 1,
+			})
+		}
+	}
+	if _, ok := unify(p.types()...); !ok {
+		errs.Add(p.Span(), &TypeError{
+			Kind:     IllegalOperands,
+			Span:     p.Span(),
+			Name:     "piecewise",
+			Operands: p.types(),
+		})
+	}
+	return errs.Err()
+}
+
+// Type returns the common type of the values
+func (p *piecewiseExp) Type() Type {
+	types := p.types()
+	if len(types) == 0 {
+		return UNKNOWN
+	}
+	t, _ := unify(types...)
+	return t
+}
+
+// Calc evaluates the conditions in order and returns the value of the first
+// branch whose condition holds, or the fallback if none holds. Only the
+// selected value is evaluated. It is a domain error if no condition holds
+// and there is no fallback.
+func (p *piecewiseExp) Calc(env *Env) (Value, error) {
+	branch := p.fallback()
+	for i := 0; i < p.branches(); i++ {
+		v, err := p.params[2*i].Calc(env)
+		if err != nil {
+			return nil, err
+		}
+		if b, _ := v.(Bool); b {
+			branch = p.params[2*i+1]
+			break
+		}
+	}
+	if branch == nil {
+		return nil, &RuntimeError{Kind: DomainError, Span: p.Span(), Name: "piecewise"}
+	}
+	r, err := branch.Calc(env)
+	if err != nil {
+		return nil, err
+	}
+	return promote(env, r, p.Type()), nil
+}
+
+func (p *piecewiseExp) Print() {
+	debug.Println("piecewise")
+	debug.Indent()
+	for _, n := range p.params {
+		n.Print()
+	}
+	debug.Outdent()
+}
+
+// NewPiecewiseOp returns the AST node for a piecewise function. The
+// parameters are pairs of a condition and a value, optionally followed by a
+// fallback value for when no condition holds.
+func NewPiecewiseOp(params []Node) Node {
+	return &piecewiseExp{params: params}
+}
@@ -0,0 +1,229 @@
+package ast
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/big"
+	"math/cmplx"
+)
+
+// DefaultMaxCallDepth is the default limit of nested calls to user functions
+const DefaultMaxCallDepth = 1000
+
+var (
+	// ErrMaxCallDepth is reported when calls to user functions are nested
+	// deeper than allowed by the environment
+	ErrMaxCallDepth = errors.New("maximum call depth exceeded")
+	// ErrMaxCalls is reported when more calls to user functions are made
+	// than allowed by the environment
+	ErrMaxCalls = errors.New("maximum number of calls exceeded")
+)
+
+// AngleMode denotes the unit of angles for trigonometric functions
+type AngleMode int
+
+const (
+	Radians AngleMode = iota
+	Degrees
+)
+
+// Env is the environment in which an abstract syntax tree is evaluated. It
+// holds the values of variables, such that a tree may be evaluated any
+// number of times with different values, and concurrently using separate
+// environments.
+type Env struct {
+	// Angle is the unit of angles for trigonometric functions
+	Angle AngleMode
+	// MaxCallDepth limits the depth of nested calls to user functions
+	MaxCallDepth int
+	// MaxCalls limits the total number of calls to user functions, if positive
+	MaxCalls int
+	// IEEE disables errors for division by zero, domain errors and overflow,
+	// such that floating point operations result in NaN or infinity instead
+	IEEE bool
+	// Integers is the precision of integer arithmetic
+	Integers IntegerMode
+	// Complex extends operations on real numbers to complex results outside
+	// their real domain, such that sqrt(-1) is i instead of an error
+	Complex bool
+	// Precision is the number of mantissa bits of floats. If zero, floats
+	// are computed in 64-bit IEEE arithmetic, and otherwise with arbitrary
+	// precision.
+	Precision uint
+
+	ctx    context.Context
+	values []Value
+	depth  int
+	calls  int
+}
+
+// NewEnv returns a new environment with default settings. Evaluation stops
+// once the context is done.
+func NewEnv(ctx context.Context) *Env {
+	return &Env{
+		MaxCallDepth: DefaultMaxCallDepth,
+		ctx:          ctx,
+	}
+}
+
+// Context returns the context of the environment
+func (e *Env) Context() context.Context {
+	return e.ctx
+}
+
+// Get returns the value of the variable in the environment, or nil if the
+// variable has no value
+func (e *Env) Get(v *Variable) Value {
+	if v.slot >= len(e.values) {
+		return nil
+	}
+	return e.values[v.slot]
+}
+
+// Set sets the value of the variable in the environment
+func (e *Env) Set(v *Variable, value Value) {
+	if v.slot >= len(e.values) {
+		values := make([]Value, v.slot+1)
+		copy(values, e.values)
+		e.values = values
+	}
+	e.values[v.slot] = value
+}
+
+// Reset clears the call counters of the environment, such that it may be
+// reused for another evaluation. Values of variables are kept.
+func (e *Env) Reset() {
+	e.depth = 0
+	e.calls = 0
+}
+
+// enter is called when n enters a user function. An error is returned if
+// the evaluation may not proceed.
+func (e *Env) enter(n Node, name string) error {
+	e.depth++
+	e.calls++
+	var err error
+	if e.depth > e.MaxCallDepth {
+		err = ErrMaxCallDepth
+	} else if e.MaxCalls > 0 && e.calls > e.MaxCalls {
+		err = ErrMaxCalls
+	} else {
+		return e.canceled(n, name)
+	}
+	return &RuntimeError{Kind: LimitExceeded, Span: n.Span(), Name: name, Err: err}
+}
+
+// leave is called when leaving a user function
+func (e *Env) leave() {
+	e.depth--
+}
+
+// canceled returns an error if the context of the environment is done
+func (e *Env) canceled(n Node, name string) error {
+	if err := e.ctx.Err(); err != nil {
+		return &RuntimeError{Kind: Canceled, Span: n.Span(), Name: name, Err: err}
+	}
+	return nil
+}
+
+// float returns the result r of applying the operation name of node n to
+// the operands. Unless in IEEE mode, an error is returned if the operation
+// produced NaN or infinity from finite operands.
+func (e *Env) float(n Node, name string, r float64, operands ...float64) (Value, error) {
+	if e.IEEE || !finite(operands...) || finite(r) {
+		return Float(r), nil
+	}
+	kind := Overflow
+	if math.IsNaN(r) {
+		kind = DomainError
+	}
+	return nil, &RuntimeError{Kind: kind, Span: n.Span(), Name: name}
+}
+
+// fail returns a runtime error for node n, unless in IEEE mode in which case
+// the fallback value is returned
+func (e *Env) fail(n Node, kind RuntimeErrorKind, name string, fallback float64) (Value, error) {
+	if e.IEEE {
+		return Float(fallback), nil
+	}
+	return nil, &RuntimeError{Kind: kind, Span: n.Span(), Name: name}
+}
+
+// toRadians converts an angle in the unit of the environment to radians
+func (e *Env) toRadians(a float64) float64 {
+	if e.Angle == Degrees {
+		return a * math.Pi / 180
+	}
+	return a
+}
+
+// fromRadians converts an angle in radians to the unit of the environment
+func (e *Env) fromRadians(a float64) float64 {
+	if e.Angle == Degrees {
+		return a * 180 / math.Pi
+	}
+	return a
+}
+
+// toRadiansBig converts an angle in the unit of the environment to radians
+func (e *Env) toRadiansBig(a *big.Float) *big.Float {
+	if e.Angle == Degrees {
+		return radiansBig(a)
+	}
+	return a
+}
+
+// fromRadiansBig converts an angle in radians to the unit of the environment
+func (e *Env) fromRadiansBig(a *big.Float) *big.Float {
+	if e.Angle == Degrees {
+		return degreesBig(a)
+	}
+	return a
+}
+
+// bigFloat returns the result r of applying the operation name of node n
+// with arbitrary precision, where ok is false if the operands are outside
+// the domain of the operation. It reports false if the operation must be
+// computed with floats instead, which is the case for errors in IEEE mode.
+func (e *Env) bigFloat(n Node, name string, r *big.Float, ok bool) (Value, bool, error) {
+	switch {
+	case ok && !r.IsInf():
+		return BigFloat{r}, true, nil
+	case e.IEEE:
+		return nil, false, nil
+	case ok:
+		return nil, true, &RuntimeError{Kind: Overflow, Span: n.Span(), Name: name}
+	}
+	return nil, true, &RuntimeError{Kind: DomainError, Span: n.Span(), Name: name}
+}
+
+// complexResult returns the complex result r of the operation name of node
+// n. Unless in IEEE mode, an error is returned if the result is not finite.
+func (e *Env) complexResult(n Node, name string, r complex128) (Value, error) {
+	if e.IEEE || !cmplx.IsNaN(r) && !cmplx.IsInf(r) {
+		return Complex(r), nil
+	}
+	if cmplx.IsNaN(r) {
+		return nil, &RuntimeError{Kind: DomainError, Span: n.Span(), Name: name}
+	}
+	return nil, &RuntimeError{Kind: Overflow, Span: n.Span(), Name: name}
+}
+
+// toRadiansComplex converts a complex angle in the unit of the environment
+// to radians
+func (e *Env) toRadiansComplex(a complex128) complex128 {
+	if e.Angle == Degrees {
+		return a * math.Pi / 180
+	}
+	return a
+}
+
+// fromRadiansComplex converts a complex angle in radians to the unit of the
+// environment
+func (e *Env) fromRadiansComplex(a complex128) complex128 {
+	if e.Angle == Degrees {
+		return a * 180 / math.Pi
+	}
+	return a
+}
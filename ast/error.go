@@ -0,0 +1,102 @@
+package ast
+
+import (
+	"fmt"
+
+	"github.com/tympanix/gocalc/scanner/token"
+)
+
+// TypeErrorKind classifies errors found during analysis
+type TypeErrorKind int
+
+const (
+	// IllegalOperands is reported when an operator is applied to operands
+	// of types it does not support
+	IllegalOperands TypeErrorKind = iota
+	// WrongArity is reported when a function is called with the wrong
+	// number of parameters
+	WrongArity
+	// IllegalArgument is reported when a function is called with an
+	// argument of a type it does not accept
+	IllegalArgument
+)
+
+// TypeError is an error found during analysis of the abstract syntax tree
+type TypeError struct {
+	Kind     TypeErrorKind
+	Span     token.Span
+	Name     string // name of the operator or function
+	Operands []Type // types of the operands, for IllegalOperands and IllegalArgument
+	Expected int    // number of parameters expected, for WrongArity
+	Got      int    // number of parameters given, for WrongArity
+	AtLeast  bool   // whether Expected is a minimum, for WrongArity
+	Arg      int    // position of the argument starting at 1, for IllegalArgument
+}
+
+// Error returns the error message prefixed with the position
+func (e *TypeError) Error() string {
+	switch e.Kind {
+	case WrongArity:
+		if e.AtLeast {
+			return fmt.Sprintf("%s: expected at least %d parameters in %s, got %d", e.Span, e.Expected, e.Name, e.Got)
+		}
+		return fmt.Sprintf("%s: expected %d parameters in %s, got %d", e.Span, e.Expected, e.Name, e.Got)
+	case IllegalArgument:
+		return fmt.Sprintf("%s: illegal argument %d for %s: %s", e.Span, e.Arg, e.Name, e.Operands[0])
+	default:
+		return fmt.Sprintf("%s: illegal operands for: %s", e.Span, e.Name)
+	}
+}
+
+// RuntimeErrorKind classifies errors occurring during evaluation
+type RuntimeErrorKind int
+
+const (
+	// DivisionByZero is reported when dividing by zero
+	DivisionByZero RuntimeErrorKind = iota
+	// DomainError is reported when an operation is applied to an operand
+	// outside of its domain, e.g. the square root of a negative number
+	DomainError
+	// Overflow is reported when a result is too large to be represented
+	Overflow
+	// LimitExceeded is reported when a limit of the environment is exceeded
+	LimitExceeded
+	// Canceled is reported when the context of the environment is done
+	Canceled
+	// UnboundVariable is reported when a variable has no value
+	UnboundVariable
+	// Inexact is reported when a value passed to or returned from a native
+	// function is not represented exactly in the type of its signature
+	Inexact
+)
+
+// RuntimeError is an error occurring during evaluation
+type RuntimeError struct {
+	Kind RuntimeErrorKind
+	Span token.Span
+	Name string // name of the operator, function or variable
+	Err  error  // underlying error, for LimitExceeded and Canceled
+}
+
+// Error returns the error message prefixed with the position
+func (e *RuntimeError) Error() string {
+	switch e.Kind {
+	case DivisionByZero:
+		return fmt.Sprintf("%s: division by zero in: %s", e.Span, e.Name)
+	case DomainError:
+		return fmt.Sprintf("%s: argument out of domain for: %s", e.Span, e.Name)
+	case Overflow:
+		return fmt.Sprintf("%s: overflow in: %s", e.Span, e.Name)
+	case UnboundVariable:
+		return fmt.Sprintf("%s: unbound variable: %s", e.Span, e.Name)
+	case Inexact:
+		return fmt.Sprintf("%s: inexact value in: %s", e.Span, e.Name)
+	default:
+		return fmt.Sprintf("%s: %s in: %s", e.Span, e.Err, e.Name)
+	}
+}
+
+// Unwrap returns the underlying error, if any
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
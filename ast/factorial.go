@@ -0,0 +1,87 @@
+package ast
+
+import (
+	"math"
+	"math/big"
+
+	"github.com/tympanix/gocalc/debug"
+	"github.com/tympanix/gocalc/diag"
+)
+
+type factorialExp struct {
+	params []Node
+	IntType
+	Location
+}
+
+// NewFactorialOp returns the AST node for the factorial function
+func NewFactorialOp(params []Node) Node {
+	return &factorialExp{params: params}
+}
+
+// Analyze checks that the function is given a single integer parameter
+func (f *factorialExp) Analyze() error {
+	var errs diag.List
+	for _, p := range f.params {
+		errs.Append(p.Analyze())
+	}
+	if len(f.params) != 1 {
+		errs.Add(f.Span(), &TypeError{
+			Kind:     WrongArity,
+			Span:     f.Span(),
+			Name:     "factorial",
+			Expected: 1,
+			Got:      len(f.params),
+		})
+	} else if t := f.params[0].Type(); !whole(t) {
+		errs.Add(f.params[0].Span(), &TypeError{
+			Kind:     IllegalArgument,
+			Span:     f.params[0].Span(),
+			Name:     "factorial",
+			Operands: []Type{t},
+			Arg:      1,
+		})
+	}
+	return errs.Err()
+}
+
+// Calc computes the factorial in 64 bits, or with arbitrary precision on
+// overflow if enabled by the environment
+func (f *factorialExp) Calc(env *Env) (Value, error) {
+	v, err := f.params[0].Calc(env)
+	if err != nil {
+		return nil, err
+	}
+	x, ok := toBig(v)
+	if !ok || x.Sign() < 0 {
+		return env.fail(f, DomainError, "factorial", math.NaN())
+	}
+	if n, ok := toInteger(v); ok {
+		r := integer{mag: 1}
+		for i := uint64(2); i <= n.mag && !r.overflow; i++ {
+			r, _ = mulInt(r, integer{mag: i})
+		}
+		if v, ok := r.value(); ok {
+			return v, nil
+		}
+	}
+	// n! has at least n*log2(n/e) bits
+	if n := ToFloat(v); env.Integers == BigIntegers && n*math.Log2(n/math.E) <= maxBigIntBits {
+		if v, ok := fromBig(new(big.Int).MulRange(1, x.Int64())); ok {
+			return v, nil
+		}
+	}
+	if env.IEEE {
+		return Float(math.Gamma(ToFloat(v) + 1)), nil
+	}
+	return nil, &RuntimeError{Kind: Overflow, Span: f.Span(), Name: "factorial"}
+}
+
+func (f *factorialExp) Print() {
+	debug.Println("factorial")
+	debug.Indent()
+	for _, p := range f.params {
+		p.Print()
+	}
+	debug.Outdent()
+}
@@ -1,18 +1,27 @@
 package ast
 
 import (
-	"fmt"
 	"math"
+	"math/big"
+	"math/cmplx"
 
 	"github.com/tympanix/gocalc/debug"
+	"github.com/tympanix/gocalc/diag"
 )
 
 type funcExp struct {
 	name    string
 	nparams int
 	params  []Node
-	fn      func(params []Node) float64
-	FloatType
+	fn      func(env *Env, args []float64) float64
+	bigs    bigFloatFunc
+	cmplx   complexFunc
+	// poles is set if the function has poles within its domain, such that
+	// an infinite result from finite arguments is a domain error
+	poles bool
+	// real is set if the result is real for complex arguments
+	real bool
+	Location
 }
 
 func (f *funcExp) Print() {
@@ -25,15 +34,99 @@ func (f *funcExp) Print() {
 }
 
 func (f *funcExp) Analyze() error {
+	var errs diag.List
+	for _, p := range f.params {
+		errs.Append(p.Analyze())
+	}
 	if len(f.params) != f.nparams {
-		return fmt.Errorf("expected %d parameters in %s, got %d", f.nparams, f.name, len(f.params))
+		errs.Add(f.Span(), &TypeError{
+			Kind:     WrongArity,
+			Span:     f.Span(),
+			Name:     f.name,
+			Expected: f.nparams,
+			Got:      len(f.params),
+		})
+	}
+	for i, p := range f.params {
+		if !numeric(p.Type()) || p.Type() == COMPLEX && f.cmplx == nil {
+			errs.Add(p.Span(), &TypeError{
+				Kind:     IllegalArgument,
+				Span:     p.Span(),
+				Name:     f.name,
+				Operands: []Type{p.Type()},
+				Arg:      i + 1,
+			})
+		}
+	}
+	return errs.Err()
+}
+
+// Type returns COMPLEX if the function has a complex result for a complex
+// argument, and FLOAT otherwise
+func (f *funcExp) Type() Type {
+	if f.cmplx != nil && !f.real {
+		for _, p := range f.params {
+			if p.Type() == COMPLEX {
+				return COMPLEX
+			}
+		}
 	}
-	return nil
+	return FLOAT
 }
 
-// Calc returns the result of the function
-func (f *funcExp) Calc() float64 {
-	return f.fn(f.params)
+// Calc returns the result of the function. If the environment enables
+// arbitrary precision, the function is computed with the precision of the
+// environment.
+func (f *funcExp) Calc(env *Env) (Value, error) {
+	values := make([]Value, len(f.params))
+	for i, p := range f.params {
+		v, err := p.Calc(env)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	if hasComplex(values...) && f.cmplx != nil {
+		return f.calcComplex(env, values)
+	}
+	if env.Precision > 0 && f.bigs != nil {
+		if args, ok := bigFloats(env.Precision, values...); ok {
+			r, ok := callBig(func() (*big.Float, bool) {
+				return f.bigs(env, args)
+			})
+			if !ok && env.Complex && f.cmplx != nil {
+				return f.calcComplex(env, values)
+			}
+			if v, ok, err := env.bigFloat(f, f.name, r, ok); ok {
+				return v, err
+			}
+		}
+	}
+	args := make([]float64, len(values))
+	for i, v := range values {
+		args[i] = ToFloat(v)
+	}
+	r := f.fn(env, args)
+	if f.poles && math.IsInf(r, 0) && finite(args...) {
+		return env.fail(f, DomainError, f.name, r)
+	}
+	if math.IsNaN(r) && finite(args...) && env.Complex && f.cmplx != nil {
+		return f.calcComplex(env, values)
+	}
+	return env.float(f, f.name, r, args...)
+}
+
+// calcComplex computes the function of complex arguments
+func (f *funcExp) calcComplex(env *Env, values []Value) (Value, error) {
+	args := make([]complex128, len(values))
+	for i, v := range values {
+		args[i], _ = toComplex(v)
+	}
+	r := f.cmplx(env, args)
+	if f.real {
+		return env.float(f, f.name, real(r))
+	}
+	return env.complexResult(f, f.name, r)
 }
 
 // NewSqrtOp returns a new square root operator
@@ -42,8 +135,17 @@ func NewSqrtOp(params []Node) Node {
 		name:    "sqrt",
 		nparams: 1,
 		params:  params,
-		fn: func(params []Node) float64 {
-			return math.Sqrt(params[0].Calc())
+		fn: func(env *Env, args []float64) float64 {
+			return math.Sqrt(args[0])
+		},
+		bigs: func(env *Env, args []*big.Float) (*big.Float, bool) {
+			if args[0].Sign() < 0 {
+				return nil, false
+			}
+			return newFloat(args[0].Prec()).Sqrt(args[0]), true
+		},
+		cmplx: func(env *Env, args []complex128) complex128 {
+			return cmplx.Sqrt(args[0])
 		},
 	}
 }
@@ -54,8 +156,15 @@ func NewLog10Op(params []Node) Node {
 		name:    "log",
 		nparams: 1,
 		params:  params,
-		fn: func(params []Node) float64 {
-			return math.Log10(params[0].Calc())
+		poles:   true,
+		fn: func(env *Env, args []float64) float64 {
+			return math.Log10(args[0])
+		},
+		bigs: func(env *Env, args []*big.Float) (*big.Float, bool) {
+			return logBaseBig(args[0], bigLn10)
+		},
+		cmplx: func(env *Env, args []complex128) complex128 {
+			return cmplx.Log10(args[0])
 		},
 	}
 }
@@ -66,8 +175,15 @@ func NewLog2Op(params []Node) Node {
 		name:    "log2",
 		nparams: 1,
 		params:  params,
-		fn: func(params []Node) float64 {
-			return math.Log2(params[0].Calc())
+		poles:   true,
+		fn: func(env *Env, args []float64) float64 {
+			return math.Log2(args[0])
+		},
+		bigs: func(env *Env, args []*big.Float) (*big.Float, bool) {
+			return log2Big(args[0])
+		},
+		cmplx: func(env *Env, args []complex128) complex128 {
+			return cmplx.Log(args[0]) / math.Ln2
 		},
 	}
 }
@@ -78,8 +194,15 @@ func NewPowFnOp(params []Node) Node {
 		name:    "pow",
 		nparams: 2,
 		params:  params,
-		fn: func(params []Node) float64 {
-			return math.Pow(params[0].Calc(), params[1].Calc())
+		fn: func(env *Env, args []float64) float64 {
+			return math.Pow(args[0], args[1])
+		},
+		bigs: func(env *Env, args []*big.Float) (*big.Float, bool) {
+			z := newFloat(args[0].Prec())
+			return z, powBigFloat(z, args[0], args[1])
+		},
+		cmplx: func(env *Env, args []complex128) complex128 {
+			return powComplex(args[0], args[1])
 		},
 	}
 }
@@ -90,8 +213,15 @@ func NewSinOp(params []Node) Node {
 		name:    "sin",
 		nparams: 1,
 		params:  params,
-		fn: func(params []Node) float64 {
-			return math.Sin(params[0].Calc())
+		fn: func(env *Env, args []float64) float64 {
+			return math.Sin(env.toRadians(args[0]))
+		},
+		bigs: func(env *Env, args []*big.Float) (*big.Float, bool) {
+			sin, _ := sinCosBig(env.toRadiansBig(args[0]))
+			return sin, true
+		},
+		cmplx: func(env *Env, args []complex128) complex128 {
+			return cmplx.Sin(env.toRadiansComplex(args[0]))
 		},
 	}
 }
@@ -102,8 +232,15 @@ func NewCosOp(params []Node) Node {
 		name:    "cos",
 		nparams: 1,
 		params:  params,
-		fn: func(params []Node) float64 {
-			return math.Cos(params[0].Calc())
+		fn: func(env *Env, args []float64) float64 {
+			return math.Cos(env.toRadians(args[0]))
+		},
+		bigs: func(env *Env, args []*big.Float) (*big.Float, bool) {
+			_, cos := sinCosBig(env.toRadiansBig(args[0]))
+			return cos, true
+		},
+		cmplx: func(env *Env, args []complex128) complex128 {
+			return cmplx.Cos(env.toRadiansComplex(args[0]))
 		},
 	}
 }
@@ -114,8 +251,15 @@ func NewTanOp(params []Node) Node {
 		name:    "tan",
 		nparams: 1,
 		params:  params,
-		fn: func(params []Node) float64 {
-			return math.Tan(params[0].Calc())
+		fn: func(env *Env, args []float64) float64 {
+			return math.Tan(env.toRadians(args[0]))
+		},
+		bigs: func(env *Env, args []*big.Float) (*big.Float, bool) {
+			sin, cos := sinCosBig(env.toRadiansBig(args[0]))
+			return sin.Quo(sin, cos), true
+		},
+		cmplx: func(env *Env, args []complex128) complex128 {
+			return cmplx.Tan(env.toRadiansComplex(args[0]))
 		},
 	}
 }
@@ -126,8 +270,18 @@ func NewAsinOp(params []Node) Node {
 		name:    "asin",
 		nparams: 1,
 		params:  params,
-		fn: func(params []Node) float64 {
-			return math.Asin(params[0].Calc())
+		fn: func(env *Env, args []float64) float64 {
+			return env.fromRadians(math.Asin(args[0]))
+		},
+		bigs: func(env *Env, args []*big.Float) (*big.Float, bool) {
+			r, ok := asinBig(args[0])
+			if !ok {
+				return nil, false
+			}
+			return env.fromRadiansBig(r), true
+		},
+		cmplx: func(env *Env, args []complex128) complex128 {
+			return env.fromRadiansComplex(cmplx.Asin(args[0]))
 		},
 	}
 }
@@ -138,8 +292,18 @@ func NewAcosOp(params []Node) Node {
 		name:    "acos",
 		nparams: 1,
 		params:  params,
-		fn: func(params []Node) float64 {
-			return math.Acos(params[0].Calc())
+		fn: func(env *Env, args []float64) float64 {
+			return env.fromRadians(math.Acos(args[0]))
+		},
+		bigs: func(env *Env, args []*big.Float) (*big.Float, bool) {
+			r, ok := acosBig(args[0])
+			if !ok {
+				return nil, false
+			}
+			return env.fromRadiansBig(r), true
+		},
+		cmplx: func(env *Env, args []complex128) complex128 {
+			return env.fromRadiansComplex(cmplx.Acos(args[0]))
 		},
 	}
 }
@@ -150,8 +314,14 @@ func NewAtanOp(params []Node) Node {
 		name:    "atan",
 		nparams: 1,
 		params:  params,
-		fn: func(params []Node) float64 {
-			return math.Atan(params[0].Calc())
+		fn: func(env *Env, args []float64) float64 {
+			return env.fromRadians(math.Atan(args[0]))
+		},
+		bigs: func(env *Env, args []*big.Float) (*big.Float, bool) {
+			return env.fromRadiansBig(atanBig(args[0])), true
+		},
+		cmplx: func(env *Env, args []complex128) complex128 {
+			return env.fromRadiansComplex(cmplx.Atan(args[0]))
 		},
 	}
 }
@@ -162,9 +332,16 @@ func NewAbsOp(params []Node) Node {
 		name:    "abs",
 		nparams: 1,
 		params:  params,
-		fn: func(params []Node) float64 {
-			return math.Abs(params[0].Calc())
+		fn: func(env *Env, args []float64) float64 {
+			return math.Abs(args[0])
+		},
+		bigs: func(env *Env, args []*big.Float) (*big.Float, bool) {
+			return newFloat(args[0].Prec()).Abs(args[0]), true
+		},
+		cmplx: func(env *Env, args []complex128) complex128 {
+			return complex(cmplx.Abs(args[0]), 0)
 		},
+		real: true,
 	}
 }
 
@@ -174,8 +351,15 @@ func NewLnOp(params []Node) Node {
 		name:    "ln",
 		nparams: 1,
 		params:  params,
-		fn: func(params []Node) float64 {
-			return math.Log(params[0].Calc())
+		poles:   true,
+		fn: func(env *Env, args []float64) float64 {
+			return math.Log(args[0])
+		},
+		bigs: func(env *Env, args []*big.Float) (*big.Float, bool) {
+			return lnBig(args[0])
+		},
+		cmplx: func(env *Env, args []complex128) complex128 {
+			return cmplx.Log(args[0])
 		},
 	}
 }
@@ -186,8 +370,11 @@ func NewDegOp(params []Node) Node {
 		name:    "deg",
 		nparams: 1,
 		params:  params,
-		fn: func(params []Node) float64 {
-			return params[0].Calc() * 180 / math.Pi
+		fn: func(env *Env, args []float64) float64 {
+			return args[0] * 180 / math.Pi
+		},
+		bigs: func(env *Env, args []*big.Float) (*big.Float, bool) {
+			return degreesBig(args[0]), true
 		},
 	}
 }
@@ -198,8 +385,11 @@ func NewRadOp(params []Node) Node {
 		name:    "rad",
 		nparams: 1,
 		params:  params,
-		fn: func(params []Node) float64 {
-			return params[0].Calc() * math.Pi / 180
+		fn: func(env *Env, args []float64) float64 {
+			return args[0] * math.Pi / 180
+		},
+		bigs: func(env *Env, args []*big.Float) (*big.Float, bool) {
+			return radiansBig(args[0]), true
 		},
 	}
 }
@@ -210,8 +400,11 @@ func NewRoundOp(params []Node) Node {
 		name:    "round",
 		nparams: 1,
 		params:  params,
-		fn: func(params []Node) float64 {
-			return math.Round(params[0].Calc())
+		fn: func(env *Env, args []float64) float64 {
+			return math.Round(args[0])
+		},
+		bigs: func(env *Env, args []*big.Float) (*big.Float, bool) {
+			return roundBig(args[0]), true
 		},
 	}
 }
@@ -222,8 +415,11 @@ func NewFloorOp(params []Node) Node {
 		name:    "floor",
 		nparams: 1,
 		params:  params,
-		fn: func(params []Node) float64 {
-			return math.Floor(params[0].Calc())
+		fn: func(env *Env, args []float64) float64 {
+			return math.Floor(args[0])
+		},
+		bigs: func(env *Env, args []*big.Float) (*big.Float, bool) {
+			return floorBig(args[0]), true
 		},
 	}
 }
@@ -234,8 +430,107 @@ func NewCeilOp(params []Node) Node {
 		name:    "ceil",
 		nparams: 1,
 		params:  params,
-		fn: func(params []Node) float64 {
-			return math.Ceil(params[0].Calc())
+		fn: func(env *Env, args []float64) float64 {
+			return math.Ceil(args[0])
+		},
+		bigs: func(env *Env, args []*big.Float) (*big.Float, bool) {
+			return ceilBig(args[0]), true
+		},
+	}
+}
+
+// NewExpOp returns the AST node for the exp function
+func NewExpOp(params []Node) Node {
+	return &funcExp{
+		name:    "exp",
+		nparams: 1,
+		params:  params,
+		fn: func(env *Env, args []float64) float64 {
+			return math.Exp(args[0])
+		},
+		bigs: func(env *Env, args []*big.Float) (*big.Float, bool) {
+			return expBig(args[0]), true
+		},
+		cmplx: func(env *Env, args []complex128) complex128 {
+			return cmplx.Exp(args[0])
+		},
+	}
+}
+
+// NewReOp returns the AST node for the real part of a complex number
+func NewReOp(params []Node) Node {
+	return &funcExp{
+		name:    "re",
+		nparams: 1,
+		params:  params,
+		fn: func(env *Env, args []float64) float64 {
+			return args[0]
+		},
+		bigs: func(env *Env, args []*big.Float) (*big.Float, bool) {
+			return args[0], true
+		},
+		cmplx: func(env *Env, args []complex128) complex128 {
+			return complex(real(args[0]), 0)
+		},
+		real: true,
+	}
+}
+
+// NewImOp returns the AST node for the imaginary part of a complex number
+func NewImOp(params []Node) Node {
+	return &funcExp{
+		name:    "im",
+		nparams: 1,
+		params:  params,
+		fn: func(env *Env, args []float64) float64 {
+			return 0
+		},
+		bigs: func(env *Env, args []*big.Float) (*big.Float, bool) {
+			return newFloat(args[0].Prec()), true
+		},
+		cmplx: func(env *Env, args []complex128) complex128 {
+			return complex(imag(args[0]), 0)
+		},
+		real: true,
+	}
+}
+
+// NewConjOp returns the AST node for the complex conjugate
+func NewConjOp(params []Node) Node {
+	return &funcExp{
+		name:    "conj",
+		nparams: 1,
+		params:  params,
+		fn: func(env *Env, args []float64) float64 {
+			return args[0]
+		},
+		bigs: func(env *Env, args []*big.Float) (*big.Float, bool) {
+			return args[0], true
+		},
+		cmplx: func(env *Env, args []complex128) complex128 {
+			return cmplx.Conj(args[0])
+		},
+	}
+}
+
+// NewArgOp returns the AST node for the argument (phase) of a complex number
+func NewArgOp(params []Node) Node {
+	return &funcExp{
+		name:    "arg",
+		nparams: 1,
+		params:  params,
+		fn: func(env *Env, args []float64) float64 {
+			return env.fromRadians(math.Atan2(0, args[0]))
+		},
+		bigs: func(env *Env, args []*big.Float) (*big.Float, bool) {
+			if args[0].Sign() < 0 {
+				return env.fromRadiansBig(bigPi.get(args[0].Prec())), true
+			}
+			return newFloat(args[0].Prec()), true
+		},
+		cmplx: func(env *Env, args []complex128) complex128 {
+			return complex(env.fromRadians(cmplx.Phase(args[0])), 0)
 		},
+		real: true,
 	}
 }
@@ -0,0 +1,208 @@
+package ast
+
+import (
+	"github.com/tympanix/gocalc/debug"
+	"github.com/tympanix/gocalc/diag"
+)
+
+// Function is a user defined function. The parameters are variables which
+// are bound to the arguments for the duration of each call.
+type Function struct {
+	Name   string
+	Params []*Variable
+	Body   Node
+	// instances holds the copies of the body typed for the types of the
+	// arguments of the calls, keyed by the types
+	instances map[string]*instance
+	// err holds the errors of the definition
+	err error
+}
+
+// instance is a copy of the body of a function typed for the types of the
+// arguments, in which the parameters are replaced by vars
+type instance struct {
+	body Node
+	vars []*Variable
+	t    Type
+	err  error
+	// analyzing is set while the body is analyzed, such that recursive
+	// calls assume the type found so far
+	analyzing bool
+}
+
+// Call returns the AST node for calling the function with the given
+// parameters. It has the same signature as the builtin function factories.
+func (f *Function) Call(params []Node) Node {
+	return &callExp{fn: f, params: params}
+}
+
+// instance returns the copy of the body typed for arguments of the given
+// types. The copy is analyzed once for every combination of types. The
+// type of a recursive function is found by analyzing the body again until
+// the type of the recursive calls agrees with the type of the body.
+func (f *Function) instance(types []Type) *instance {
+	key := make([]byte, len(types))
+	for i, t := range types {
+		key[i] = byte(t)
+	}
+	if inst, ok := f.instances[string(key)]; ok {
+		return inst
+	}
+	if f.instances == nil {
+		f.instances = make(map[string]*instance)
+	}
+	inst := &instance{vars: make([]*Variable, len(f.Params)), analyzing: true}
+	f.instances[string(key)] = inst
+
+	subst := make(map[*Variable]*Variable, len(f.Params))
+	for i, v := range f.Params {
+		inst.vars[i] = &Variable{Name: v.Name, t: types[i], slot: v.slot}
+		subst[v] = inst.vars[i]
+	}
+	inst.body = clone(f.Body, subst)
+	for {
+		inst.err = inst.body.Analyze()
+		t, ok := unify(inst.t, inst.body.Type())
+		if !ok || t == inst.t {
+			break
+		}
+		inst.t = t
+	}
+	inst.analyzing = false
+	return inst
+}
+
+type callExp struct {
+	fn     *Function
+	params []Node
+	inst   *instance
+	Location
+}
+
+// Analyze types the call from the copy of the body of the function typed
+// for the arguments. Errors in the body, which are not errors of the
+// definition, are reported at the call.
+func (c *callExp) Analyze() error {
+	var errs diag.List
+	for _, p := range c.params {
+		errs.Append(p.Analyze())
+	}
+	if len(c.params) != len(c.fn.Params) {
+		errs.Add(c.Span(), &TypeError{
+			Kind:     WrongArity,
+			Span:     c.Span(),
+			Name:     c.fn.Name,
+			Expected: len(c.fn.Params),
+			Got:      len(c.params),
+		})
+		return errs.Err()
+	}
+	types := make([]Type, len(c.params))
+	for i, p := range c.params {
+		types[i] = p.Type()
+	}
+	c.inst = c.fn.instance(types)
+	if c.inst.err != nil && c.fn.err == nil && !c.inst.analyzing {
+		errs.Add(c.Span(), &TypeError{
+			Kind:     IllegalOperands,
+			Span:     c.Span(),
+			Name:     c.fn.Name,
+			Operands: types,
+		})
+	}
+	return errs.Err()
+}
+
+// Type returns the type of the body typed for the arguments, or UNKNOWN if
+// the arguments do not match the parameters
+func (c *callExp) Type() Type {
+	if c.inst == nil {
+		return UNKNOWN
+	}
+	return c.inst.t
+}
+
+// Calc binds the arguments to the parameters and evaluates the body. The
+// previous values of the parameters are restored afterwards, such that
+// recursive calls do not interfere. The evaluation fails if the limits of
+// the environment are exceeded.
+func (c *callExp) Calc(env *Env) (Value, error) {
+	defer env.leave()
+	if err := env.enter(c, c.fn.Name); err != nil {
+		return nil, err
+	}
+	args := make([]Value, len(c.params))
+	for i, p := range c.params {
+		v, err := p.Calc(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	saved := make([]Value, len(c.inst.vars))
+	for i, v := range c.inst.vars {
+		saved[i] = env.Get(v)
+		env.Set(v, args[i])
+	}
+	result, err := c.inst.body.Calc(env)
+	for i, v := range c.inst.vars {
+		env.Set(v, saved[i])
+	}
+	return result, err
+}
+
+func (c *callExp) Print() {
+	debug.Println(c.fn.Name)
+	debug.Indent()
+	for _, p := range c.params {
+		p.Print()
+	}
+	debug.Outdent()
+}
+
+type defineExp struct {
+	fn *Function
+	Location
+}
+
+// Analyze analyzes the body of the function once with parameters of the
+// UNKNOWN type, which are assumed to have any type the body requires, such
+// that errors which do not depend on the arguments are reported even if the
+// function is never called
+func (d *defineExp) Analyze() error {
+	d.fn.instances = nil
+	types := make([]Type, len(d.fn.Params))
+	for i := range types {
+		types[i] = UNKNOWN
+	}
+	d.fn.err = d.fn.instance(types).err
+	return d.fn.err
+}
+
+// Calc does not evaluate anything, since the function is evaluated when
+// called. The result is a nil value.
+func (d *defineExp) Calc(env *Env) (Value, error) {
+	return nil, nil
+}
+
+func (d *defineExp) Type() Type {
+	return UNKNOWN
+}
+
+func (d *defineExp) Print() {
+	debug.Println("=")
+	debug.Indent()
+	debug.Println(d.fn.Name)
+	debug.Indent()
+	for _, v := range d.fn.Params {
+		debug.Println(v.Name)
+	}
+	debug.Outdent()
+	d.fn.Body.Print()
+	debug.Outdent()
+}
+
+// NewDefineExp returns the AST node for the definition of a user function
+func NewDefineExp(fn *Function) Node {
+	return &defineExp{fn: fn}
+}
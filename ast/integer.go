@@ -0,0 +1,205 @@
+package ast
+
+import (
+	"math"
+	"math/bits"
+)
+
+// integer is an integer value in sign and magnitude form, such that
+// arithmetic on both Int and Uint values can be computed exactly. The
+// overflow flag is set once a result no longer fits in 64 bits.
+type integer struct {
+	neg      bool
+	mag      uint64
+	overflow bool
+}
+
+// intOp is an operation on integers. It reports false if the result is not
+// an integer, in which case the operation is computed with floats instead.
+type intOp func(a, b integer) (integer, bool)
+
+// toInteger returns the value as an integer, if it is one
+func toInteger(v Value) (integer, bool) {
+	switch v := v.(type) {
+	case Int:
+		return fromInt64(int64(v)), true
+	case Uint:
+		return integer{mag: uint64(v)}, true
+	}
+	return integer{}, false
+}
+
+func fromInt64(i int64) integer {
+	if i < 0 {
+		return integer{neg: true, mag: uint64(-(i + 1)) + 1}
+	}
+	return integer{mag: uint64(i)}
+}
+
+// fromFloat returns the float as an integer value, if it is integral and
+// within the range of 64-bit integers
+func fromFloat(f float64) (Value, bool) {
+	if f != math.Trunc(f) || math.IsInf(f, 0) {
+		return nil, false
+	}
+	if f < 0 {
+		if f < math.MinInt64 {
+			return nil, false
+		}
+		return Int(f), true
+	}
+	if f >= 1<<64 {
+		return nil, false
+	}
+	return integer{mag: uint64(f)}.value()
+}
+
+// value returns the integer as an Int, or as an Uint if it is too large to
+// be an Int. It reports false if the integer does not fit in either.
+func (i integer) value() (Value, bool) {
+	switch {
+	case i.overflow:
+		return nil, false
+	case !i.neg && i.mag <= math.MaxInt64:
+		return Int(i.mag), true
+	case !i.neg:
+		return Uint(i.mag), true
+	case i.mag <= 1<<63:
+		return Int(-int64(i.mag-1) - 1), true
+	}
+	return nil, false
+}
+
+// unsigned reports whether the integer is only representable as an Uint
+func (i integer) unsigned() bool {
+	return !i.neg && i.mag > math.MaxInt64
+}
+
+// bits returns the two's complement bit pattern of the integer
+func (i integer) bits() uint64 {
+	if i.neg {
+		return -i.mag
+	}
+	return i.mag
+}
+
+func (i integer) negate() integer {
+	i.neg = !i.neg && i.mag != 0
+	return i
+}
+
+func addInt(a, b integer) (integer, bool) {
+	r := integer{overflow: a.overflow || b.overflow}
+	if a.neg == b.neg {
+		var carry uint64
+		r.mag, carry = bits.Add64(a.mag, b.mag, 0)
+		r.neg = a.neg
+		r.overflow = r.overflow || carry != 0
+	} else if a.mag >= b.mag {
+		r.mag, r.neg = a.mag-b.mag, a.neg
+	} else {
+		r.mag, r.neg = b.mag-a.mag, b.neg
+	}
+	r.neg = r.neg && r.mag != 0
+	return r, true
+}
+
+func subInt(a, b integer) (integer, bool) {
+	return addInt(a, b.negate())
+}
+
+func mulInt(a, b integer) (integer, bool) {
+	hi, lo := bits.Mul64(a.mag, b.mag)
+	return integer{
+		neg:      a.neg != b.neg && lo != 0,
+		mag:      lo,
+		overflow: a.overflow || b.overflow || hi != 0,
+	}, true
+}
+
+// powInt computes the power by repeated squaring. Negative exponents do not
+// result in integers.
+func powInt(a, b integer) (integer, bool) {
+	if b.neg {
+		return integer{}, false
+	}
+	r := integer{mag: 1}
+	for e := b.mag; e > 0; e >>= 1 {
+		if e&1 == 1 {
+			r, _ = mulInt(r, a)
+		}
+		if e > 1 {
+			a, _ = mulInt(a, a)
+		}
+		if r.overflow || a.overflow {
+			r.overflow = true
+			break
+		}
+	}
+	return r, true
+}
+
+// modInt computes the remainder truncated towards zero, like the %
+// operator of Go. The divisor must not be zero.
+func modInt(a, b integer) (integer, bool) {
+	r := integer{mag: a.mag % b.mag}
+	r.neg = a.neg && r.mag != 0
+	return r, true
+}
+
+// bitwise returns an operation on the two's complement bit patterns of
+// the operands. The result is unsigned if either operand is.
+func bitwise(fn func(a, b uint64) uint64) intOp {
+	return func(a, b integer) (integer, bool) {
+		r := fn(a.bits(), b.bits())
+		if a.unsigned() || b.unsigned() {
+			return integer{mag: r}, true
+		}
+		return fromInt64(int64(r)), true
+	}
+}
+
+// shlInt shifts the magnitude to the left, which multiplies by a power of
+// two. Negative shift counts do not result in integers.
+func shlInt(a, b integer) (integer, bool) {
+	if b.neg {
+		return integer{}, false
+	}
+	if a.mag != 0 && (b.mag >= 64 || uint64(bits.LeadingZeros64(a.mag)) < b.mag) {
+		return integer{overflow: true}, true
+	}
+	a.mag <<= b.mag
+	return a, true
+}
+
+// shrInt shifts to the right arithmetically, which divides by a power of two
+// rounding towards negative infinity. Negative shift counts do not result in
+// integers.
+func shrInt(a, b integer) (integer, bool) {
+	if b.neg {
+		return integer{}, false
+	}
+	if a.neg {
+		return integer{neg: true, mag: (a.mag-1)>>b.mag + 1}, true
+	}
+	return integer{mag: a.mag >> b.mag}, true
+}
+
+// ushrInt shifts the two's complement bit pattern to the right, filling in
+// zeros from the left. Negative shift counts do not result in integers.
+func ushrInt(a, b integer) (integer, bool) {
+	if b.neg {
+		return integer{}, false
+	}
+	return integer{mag: a.bits() >> b.mag}, true
+}
+
+// complement returns the bitwise complement of the integer, which is
+// unsigned if the integer is
+func (i integer) complement() integer {
+	if i.unsigned() {
+		return integer{mag: ^i.mag}
+	}
+	r, _ := subInt(i.negate(), integer{mag: 1})
+	return r
+}
@@ -2,47 +2,97 @@ package ast
 
 import (
 	"math"
+	"math/big"
+	"strconv"
 
 	"github.com/tympanix/gocalc/debug"
 )
 
 type literal struct {
-	n float64
-	t Type
+	v    Value
+	text string // source of float literals
 	NopAnalyzer
+	Location
 }
 
-func (l *literal) Calc() float64 {
-	return l.n
+// Calc returns the value of the literal. Integer literals which do not fit
+// in 64 bits overflow unless the environment enables arbitrary precision.
+func (l *literal) Calc(env *Env) (Value, error) {
+	if _, ok := l.v.(BigInt); ok && env.Integers != BigIntegers {
+		if env.IEEE {
+			return Float(ToFloat(l.v)), nil
+		}
+		return nil, &RuntimeError{Kind: Overflow, Span: l.Span(), Name: "literal"}
+	}
+	if len(l.text) > 0 && env.Precision > 0 {
+		if f, _, err := big.ParseFloat(l.text, 0, env.Precision, big.ToNearestEven); err == nil {
+			return BigFloat{f}, nil
+		}
+	}
+	return l.v, nil
 }
 
 func (l *literal) Print() {
-	debug.Println(l.n)
+	debug.Println(l.v)
 }
 
 func (l *literal) Type() Type {
-	return l.t
+	return l.v.Type()
 }
 
 // NewFloatLiteral returns the AST node for float literals
 func NewFloatLiteral(n float64) Node {
-	return &literal{n: n, t: FLOAT}
+	return &literal{v: Float(n)}
+}
+
+// NewDecimalLiteral returns the AST node for float literals given by their
+// decimal or hexadecimal representation, such that they can be evaluated
+// with arbitrary precision
+func NewDecimalLiteral(text string) (Node, error) {
+	n, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &literal{v: Float(n), text: text}, nil
 }
 
 // NewIntegerLiteral returns the AST node for integer literals
-func NewIntegerLiteral(n float64) Node {
-	return &literal{n: n, t: INTEGER}
+func NewIntegerLiteral(n uint64) Node {
+	v, _ := integer{mag: n}.value()
+	return &literal{v: v}
+}
+
+// NewBigIntegerLiteral returns the AST node for integer literals which may
+// not fit in 64 bits
+func NewBigIntegerLiteral(x *big.Int) Node {
+	v, ok := fromBig(x)
+	if !ok {
+		v = BigInt{x}
+	}
+	return &literal{v: v}
+}
+
+// NewImaginaryLiteral returns the AST node for imaginary literals
+func NewImaginaryLiteral(n float64) Node {
+	return &literal{v: Complex(complex(0, n))}
 }
 
 type constantExp struct {
-	name  string
-	t     Type
-	value float64
+	name string
+	t    Type
+	v    Value
+	bigf *bigConst
 	NopAnalyzer
+	Location
 }
 
-func (c *constantExp) Calc() float64 {
-	return c.value
+// Calc returns the value of the constant, which is computed with the
+// precision of the environment if possible
+func (c *constantExp) Calc(env *Env) (Value, error) {
+	if c.bigf != nil && env.Precision > 0 {
+		return BigFloat{c.bigf.get(env.Precision)}, nil
+	}
+	return c.v, nil
 }
 
 func (c *constantExp) Print() {
@@ -53,12 +103,52 @@ func (c *constantExp) Type() Type {
 	return c.t
 }
 
+// NewConstantOp returns the AST node for a named constant. The value of an
+// INTEGER constant is truncated to an integer.
+func NewConstantOp(name string, t Type, value float64) Node {
+	var v Value = Float(value)
+	if t == INTEGER {
+		if i, ok := fromFloat(math.Trunc(value)); ok {
+			v = i
+		}
+	}
+	return &constantExp{name: name, t: t, v: v}
+}
+
 // NewPiOp return the AST node for PI
 func NewPiOp() Node {
-	return &constantExp{name: "pi", t: FLOAT, value: math.Pi}
+	return &constantExp{name: "pi", t: FLOAT, v: Float(math.Pi), bigf: bigPi}
 }
 
 // NewEulerOp returns the AST node for Eurler's number
 func NewEulerOp() Node {
-	return &constantExp{name: "e", t: FLOAT, value: math.E}
+	return &constantExp{name: "e", t: FLOAT, v: Float(math.E), bigf: bigE}
+}
+
+type badExp struct {
+	NopAnalyzer
+	Location
+}
+
+// Calc returns NaN, since programs with syntax errors are not evaluated
+func (b *badExp) Calc(env *Env) (Value, error) {
+	return Float(math.NaN()), nil
+}
+
+func (b *badExp) Print() {
+	debug.Println("<bad>")
+}
+
+func (b *badExp) Type() Type {
+	return UNKNOWN
+}
+
+// NewBadExp returns a placeholder AST node for an expression with syntax errors
+func NewBadExp() Node {
+	return &badExp{}
+}
+
+// NewImaginaryUnitOp returns the AST node for the imaginary unit
+func NewImaginaryUnitOp() Node {
+	return &constantExp{name: "i", t: COMPLEX, v: Complex(1i)}
 }
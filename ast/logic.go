@@ -0,0 +1,315 @@
+package ast
+
+import (
+	"math/big"
+
+	"github.com/tympanix/gocalc/debug"
+	"github.com/tympanix/gocalc/diag"
+)
+
+type compareExp struct {
+	name string
+	lhs  Node
+	rhs  Node
+	// test reports whether the comparison holds for the sign of lhs - rhs
+	test func(c int) bool
+	// ordered is set if the operands must be ordered, i.e. the comparison
+	// is not an equality
+	ordered bool
+	Location
+}
+
+// Analyze checks that the operands are comparable. Numbers are ordered,
+// except for complex numbers, which can only be tested for equality along
+// with booleans.
+func (c *compareExp) Analyze() error {
+	var errs diag.List
+	errs.Append(c.lhs.Analyze())
+	errs.Append(c.rhs.Analyze())
+	l, r := c.lhs.Type(), c.rhs.Type()
+	ok := numeric(l) && numeric(r)
+	if c.ordered {
+		ok = ok && l != COMPLEX && r != COMPLEX
+	} else if boolean(l) && boolean(r) {
+		ok = true
+	}
+	if !ok {
+		errs.Add(c.Span(), &TypeError{
+			Kind:     IllegalOperands,
+			Span:     c.Span(),
+			Name:     c.name,
+			Operands: []Type{l, r},
+		})
+	}
+	return errs.Err()
+}
+
+func (c *compareExp) Type() Type {
+	return BOOLEAN
+}
+
+// Calc compares the operands exactly. Comparisons with NaN do not hold,
+// except for inequality.
+func (c *compareExp) Calc(env *Env) (Value, error) {
+	lhs, err := c.lhs.Calc(env)
+	if err != nil {
+		return nil, err
+	}
+	rhs, err := c.rhs.Calc(env)
+	if err != nil {
+		return nil, err
+	}
+	if x, ok := lhs.(Bool); ok {
+		y, _ := rhs.(Bool)
+		return Bool(c.test(boolCmp(bool(x), bool(y)))), nil
+	}
+	if hasComplex(lhs, rhs) {
+		x, _ := toComplex(lhs)
+		y, _ := toComplex(rhs)
+		return Bool(c.test(boolCmp(x == y, true))), nil
+	}
+	r, ok := compare(env, lhs, rhs)
+	if !ok {
+		return Bool(!c.ordered && !c.test(0)), nil
+	}
+	return Bool(c.test(r)), nil
+}
+
+func (c *compareExp) Print() {
+	debug.Println(c.name)
+	debug.Indent()
+	c.lhs.Print()
+	c.rhs.Print()
+	debug.Outdent()
+}
+
+// boolCmp returns 0 if the booleans are equal, and 1 otherwise
+func boolCmp(x, y bool) int {
+	if x == y {
+		return 0
+	}
+	return 1
+}
+
+// compare returns the sign of x - y for real numbers. Exact numbers and
+// finite floats are compared exactly. It reports false if the numbers are
+// not ordered, which is the case if either is NaN.
+func compare(env *Env, x, y Value) (int, bool) {
+	_, xbig := x.(BigFloat)
+	_, ybig := y.(BigFloat)
+	if xbig || ybig {
+		bx, xok := toBigFloat(x, env.Precision)
+		by, yok := toBigFloat(y, env.Precision)
+		if xok && yok {
+			return bx.Cmp(by), true
+		}
+	} else if rx, ok := ratOf(x); ok {
+		if ry, ok := ratOf(y); ok {
+			return rx.Cmp(ry), true
+		}
+	}
+	fx, fy := ToFloat(x), ToFloat(y)
+	switch {
+	case fx < fy:
+		return -1, true
+	case fx > fy:
+		return 1, true
+	case fx == fy:
+		return 0, true
+	}
+	return 0, false
+}
+
+// ratOf returns the exact value of an exact number or a finite float
+func ratOf(v Value) (*big.Rat, bool) {
+	if f, ok := v.(Float); ok {
+		if !finite(float64(f)) {
+			return nil, false
+		}
+		return new(big.Rat).SetFloat64(float64(f)), true
+	}
+	return toRat(v)
+}
+
+// NewEqualOp returns the AST node for the equality (==) operator
+func NewEqualOp(lhs Node, rhs Node) Node {
+	return &compareExp{
+		name: "==",
+		lhs:  lhs,
+		rhs:  rhs,
+		test: func(c int) bool {
+			return c == 0
+		},
+	}
+}
+
+// NewNotEqualOp returns the AST node for the inequality (!=) operator
+func NewNotEqualOp(lhs Node, rhs Node) Node {
+	return &compareExp{
+		name: "!=",
+		lhs:  lhs,
+		rhs:  rhs,
+		test: func(c int) bool {
+			return c != 0
+		},
+	}
+}
+
+// NewLessOp returns the AST node for the less than (<) operator
+func NewLessOp(lhs Node, rhs Node) Node {
+	return &compareExp{
+		name: "<",
+		lhs:  lhs,
+		rhs:  rhs,
+		test: func(c int) bool {
+			return c < 0
+		},
+		ordered: true,
+	}
+}
+
+// NewLessEqualOp returns the AST node for the less than or equal (<=) operator
+func NewLessEqualOp(lhs Node, rhs Node) Node {
+	return &compareExp{
+		name: "<=",
+		lhs:  lhs,
+		rhs:  rhs,
+		test: func(c int) bool {
+			return c <= 0
+		},
+		ordered: true,
+	}
+}
+
+// NewGreaterOp returns the AST node for the greater than (>) operator
+func NewGreaterOp(lhs Node, rhs Node) Node {
+	return &compareExp{
+		name: ">",
+		lhs:  lhs,
+		rhs:  rhs,
+		test: func(c int) bool {
+			return c > 0
+		},
+		ordered: true,
+	}
+}
+
+// NewGreaterEqualOp returns the AST node for the greater than or equal (>=)
+// operator
+func NewGreaterEqualOp(lhs Node, rhs Node) Node {
+	return &compareExp{
+		name: ">=",
+		lhs:  lhs,
+		rhs:  rhs,
+		test: func(c int) bool {
+			return c >= 0
+		},
+		ordered: true,
+	}
+}
+
+type logicalExp struct {
+	name string
+	lhs  Node
+	rhs  Node
+	// short is the value of the left-hand side which determines the
+	// result, such that the right-hand side is not evaluated
+	short bool
+	Location
+}
+
+// Analyze checks that both operands are booleans
+func (l *logicalExp) Analyze() error {
+	var errs diag.List
+	errs.Append(l.lhs.Analyze())
+	errs.Append(l.rhs.Analyze())
+	if !boolean(l.lhs.Type()) || !boolean(l.rhs.Type()) {
+		errs.Add(l.Span(), &TypeError{
+			Kind:     IllegalOperands,
+			Span:     l.Span(),
+			Name:     l.name,
+			Operands: []Type{l.lhs.Type(), l.rhs.Type()},
+		})
+	}
+	return errs.Err()
+}
+
+func (l *logicalExp) Type() Type {
+	return BOOLEAN
+}
+
+// Calc evaluates the right-hand side only if the left-hand side does not
+// determine the result
+func (l *logicalExp) Calc(env *Env) (Value, error) {
+	lhs, err := l.lhs.Calc(env)
+	if err != nil {
+		return nil, err
+	}
+	if x, _ := lhs.(Bool); bool(x) == l.short {
+		return x, nil
+	}
+	return l.rhs.Calc(env)
+}
+
+func (l *logicalExp) Print() {
+	debug.Println(l.name)
+	debug.Indent()
+	l.lhs.Print()
+	l.rhs.Print()
+	debug.Outdent()
+}
+
+// NewLogicalAndOp returns the AST node for the logical and (&&) operator
+func NewLogicalAndOp(lhs Node, rhs Node) Node {
+	return &logicalExp{name: "&&", lhs: lhs, rhs: rhs, short: false}
+}
+
+// NewLogicalOrOp returns the AST node for the logical or (||) operator
+func NewLogicalOrOp(lhs Node, rhs Node) Node {
+	return &logicalExp{name: "||", lhs: lhs, rhs: rhs, short: true}
+}
+
+type notExp struct {
+	param Node
+	Location
+}
+
+// Analyze checks that the operand is a boolean
+func (n *notExp) Analyze() error {
+	var errs diag.List
+	errs.Append(n.param.Analyze())
+	if !boolean(n.param.Type()) {
+		errs.Add(n.Span(), &TypeError{
+			Kind:     IllegalOperands,
+			Span:     n.Span(),
+			Name:     "!",
+			Operands: []Type{n.param.Type()},
+		})
+	}
+	return errs.Err()
+}
+
+func (n *notExp) Type() Type {
+	return BOOLEAN
+}
+
+func (n *notExp) Calc(env *Env) (Value, error) {
+	v, err := n.param.Calc(env)
+	if err != nil {
+		return nil, err
+	}
+	b, _ := v.(Bool)
+	return !b, nil
+}
+
+func (n *notExp) Print() {
+	debug.Println("!")
+	debug.Indent()
+	n.param.Print()
+	debug.Outdent()
+}
+
+// NewNotOp returns the AST node for the logical negation (!) operator
+func NewNotOp(param Node) Node {
+	return &notExp{param: param}
+}
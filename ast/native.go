@@ -0,0 +1,188 @@
+package ast
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/tympanix/gocalc/debug"
+	"github.com/tympanix/gocalc/diag"
+)
+
+// Signature describes the parameter and result types of a function.
+// Variadic functions accept any number of trailing parameters of the type of
+// the last parameter, including none. A FLOAT parameter accepts INTEGER and
+// RATIONAL arguments, while an UNKNOWN parameter accepts arguments of any type.
+//
+// The arguments and the result are passed as floats. INTEGER and RATIONAL
+// arguments must be represented exactly, and an INTEGER result must be an
+// integer, or the call fails with an Inexact error. A RATIONAL result is the
+// exact value of the float.
+type Signature struct {
+	Params   []Type
+	Variadic bool
+	Result   Type
+}
+
+// Validate checks that the types of the signature can be passed as floats,
+// and that a variadic signature has a parameter
+func (s Signature) Validate() error {
+	if s.Variadic && len(s.Params) == 0 {
+		return errors.New("variadic signature without parameters")
+	}
+	for i, t := range s.Params {
+		if t == COMPLEX || t == BOOLEAN {
+			return fmt.Errorf("parameter %d of type %s can not be passed as float", i+1, t)
+		}
+	}
+	if s.Result == COMPLEX || s.Result == BOOLEAN {
+		return fmt.Errorf("result of type %s can not be passed as float", s.Result)
+	}
+	return nil
+}
+
+// param returns the type of the i'th parameter
+func (s Signature) param(i int) Type {
+	if i >= len(s.Params) {
+		return s.Params[len(s.Params)-1]
+	}
+	return s.Params[i]
+}
+
+// accepts reports whether n parameters may be given
+func (s Signature) accepts(n int) bool {
+	if s.Variadic {
+		return n >= len(s.Params)-1
+	}
+	return n == len(s.Params)
+}
+
+type nativeExp struct {
+	name   string
+	sig    Signature
+	params []Node
+	impl   func(args []float64) float64
+	Location
+}
+
+// NewNativeFunc returns a factory for AST nodes calling impl with the values
+// of the parameters. The factory has the same signature as the builtin
+// function constructors.
+func NewNativeFunc(name string, sig Signature, impl func(args []float64) float64) func(params []Node) Node {
+	return func(params []Node) Node {
+		return &nativeExp{
+			name:   name,
+			sig:    sig,
+			params: params,
+			impl:   impl,
+		}
+	}
+}
+
+// Analyze analyzes the parameters and checks them against the signature
+func (n *nativeExp) Analyze() error {
+	var errs diag.List
+	for _, p := range n.params {
+		errs.Append(p.Analyze())
+	}
+	if !n.sig.accepts(len(n.params)) {
+		min := len(n.sig.Params)
+		if n.sig.Variadic {
+			min--
+		}
+		errs.Add(n.Span(), &TypeError{
+			Kind:     WrongArity,
+			Span:     n.Span(),
+			Name:     n.name,
+			Expected: min,
+			Got:      len(n.params),
+			AtLeast:  n.sig.Variadic,
+		})
+		return errs.Err()
+	}
+	for i, p := range n.params {
+		if !accepts(n.sig.param(i), p.Type()) {
+			errs.Add(p.Span(), &TypeError{
+				Kind:     IllegalArgument,
+				Span:     p.Span(),
+				Name:     n.name,
+				Operands: []Type{p.Type()},
+				Arg:      i + 1,
+			})
+		}
+	}
+	return errs.Err()
+}
+
+// accepts reports whether a parameter of type param accepts an argument of
+// type arg. Arguments of the UNKNOWN type, such as the parameters of a
+// function definition, are accepted.
+func accepts(param Type, arg Type) bool {
+	switch {
+	case param == UNKNOWN || arg == UNKNOWN:
+		return true
+	case param == FLOAT:
+		return arg == FLOAT || arg == INTEGER || arg == RATIONAL
+	}
+	return param == arg
+}
+
+// Type returns the result type of the signature, defaulting to FLOAT
+func (n *nativeExp) Type() Type {
+	if n.sig.Result == UNKNOWN {
+		return FLOAT
+	}
+	return n.sig.Result
+}
+
+// Calc converts the arguments to floats and the result to the result type
+// of the signature. Exact arguments which are not represented exactly and
+// results which are not of the result type are errors.
+func (n *nativeExp) Calc(env *Env) (Value, error) {
+	args := make([]float64, len(n.params))
+	for i, p := range n.params {
+		v, err := p.Calc(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = ToFloat(v)
+		if t := n.sig.param(i); exact(t) && !representable(v, args[i]) {
+			return nil, &RuntimeError{Kind: Inexact, Span: p.Span(), Name: n.name}
+		}
+	}
+	r := n.impl(args)
+	if !finite(r) {
+		return env.float(n, n.name, r, args...)
+	}
+	switch n.Type() {
+	case INTEGER:
+		if i, ok := fromFloat(r); ok {
+			return i, nil
+		}
+		return env.fail(n, Inexact, n.name, r)
+	case RATIONAL:
+		return Rat{new(big.Rat).SetFloat64(r)}, nil
+	}
+	return Float(r), nil
+}
+
+// representable reports whether the float f equals the value v, if v is
+// exact. Floats, such as integers which overflow in IEEE mode, are passed
+// as they are.
+func representable(v Value, f float64) bool {
+	x, ok := toRat(v)
+	if !ok {
+		return true
+	}
+	return !math.IsInf(f, 0) && new(big.Rat).SetFloat64(f).Cmp(x) == 0
+}
+
+func (n *nativeExp) Print() {
+	debug.Println(n.name)
+	debug.Indent()
+	for _, p := range n.params {
+		p.Print()
+	}
+	debug.Outdent()
+}
@@ -0,0 +1,72 @@
+package ast
+
+import "github.com/tympanix/gocalc/diag"
+
+// Program is the root of the abstract syntax tree. It holds a list of
+// statements which are evaluated in order.
+type Program struct {
+	Statements []Node
+	Location
+}
+
+// NewProgram returns a new program without any statements
+func NewProgram() *Program {
+	return &Program{}
+}
+
+// Add appends a statement to the program
+func (p *Program) Add(stmt Node) {
+	p.Statements = append(p.Statements, stmt)
+	p.SetSpan(p.Span().Join(stmt.Span()))
+}
+
+// Analyze analyzes every statement of the program
+func (p *Program) Analyze() error {
+	var errs diag.List
+	for _, stmt := range p.Statements {
+		errs.Append(stmt.Analyze())
+	}
+	return errs.Err()
+}
+
+// Type returns the type of the last statement
+func (p *Program) Type() Type {
+	if len(p.Statements) == 0 {
+		return UNKNOWN
+	}
+	return p.Statements[len(p.Statements)-1].Type()
+}
+
+// Calc evaluates every statement and returns the result of the last one.
+// The evaluation stops at the first error. The result of an empty program is
+// a nil value.
+func (p *Program) Calc(env *Env) (Value, error) {
+	var result Value
+	for _, stmt := range p.Statements {
+		if err := env.canceled(stmt, "program"); err != nil {
+			return nil, err
+		}
+		var err error
+		if result, err = stmt.Calc(env); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// Print prints every statement of the program
+func (p *Program) Print() {
+	for _, stmt := range p.Statements {
+		stmt.Print()
+	}
+}
+
+// IsAssignment reports whether the statement is an assignment or a
+// function definition
+func IsAssignment(stmt Node) bool {
+	switch stmt.(type) {
+	case *assignExp, *defineExp:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package ast
+
+import (
+	"math"
+	"math/big"
+	"strings"
+)
+
+// decimalDigits is the number of decimals shown for rational numbers which
+// have no finite decimal representation
+const decimalDigits = 16
+
+// RatFormat denotes the textual representation of rational numbers
+type RatFormat int
+
+const (
+	// Fraction shows rational numbers as a reduced fraction, e.g. 7/3
+	Fraction RatFormat = iota
+	// Mixed shows rational numbers as a mixed number, e.g. 2 1/3
+	Mixed
+	// Decimal shows rational numbers as a decimal number, e.g. 2.3333
+	Decimal
+)
+
+// Rat is a value of type RATIONAL. It must not be modified.
+type Rat struct {
+	*big.Rat
+}
+
+// Type returns the rational type
+func (r Rat) Type() Type {
+	return RATIONAL
+}
+
+// String returns the rational number as a reduced fraction
+func (r Rat) String() string {
+	return r.Text(Fraction)
+}
+
+// Text returns the rational number in the given format
+func (r Rat) Text(f RatFormat) string {
+	switch f {
+	case Mixed:
+		if r.IsInt() || r.Num().CmpAbs(r.Denom()) < 0 {
+			return r.RatString()
+		}
+		q, m := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+		return q.String() + " " + new(big.Rat).SetFrac(m.Abs(m), r.Denom()).String()
+	case Decimal:
+		s := r.FloatString(finiteDecimals(r.Denom()))
+		if strings.Contains(s, ".") {
+			s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+		}
+		return s
+	}
+	return r.RatString()
+}
+
+// finiteDecimals returns the number of decimals of fractions with the given
+// denominator, or decimalDigits if the decimals do not terminate
+func finiteDecimals(d *big.Int) int {
+	d = new(big.Int).Set(d)
+	n := 0
+	for _, p := range []int64{2, 5} {
+		k := 0
+		m := new(big.Int)
+		for {
+			q, r := new(big.Int).QuoRem(d, big.NewInt(p), m)
+			if r.Sign() != 0 {
+				break
+			}
+			d = q
+			k++
+		}
+		if k > n {
+			n = k
+		}
+	}
+	if d.Cmp(big.NewInt(1)) != 0 {
+		return decimalDigits
+	}
+	return n
+}
+
+// exact reports whether values of the type are computed exactly
+func exact(t Type) bool {
+	return t == INTEGER || t == RATIONAL
+}
+
+// ratOp is an operation on rational numbers, storing the result in z. It
+// reports false if the result is not rational.
+type ratOp func(z, x, y *big.Rat) bool
+
+// toRat returns the value as a rational number, if it is an integer or a
+// rational number
+func toRat(v Value) (*big.Rat, bool) {
+	if r, ok := v.(Rat); ok {
+		return r.Rat, true
+	}
+	if i, ok := toBig(v); ok {
+		return new(big.Rat).SetInt(i), true
+	}
+	return nil, false
+}
+
+// toIntegral returns a rational number which is an integer as an integer
+// value, as operands of the integer operators may be powers with a negative
+// exponent. It reports false for rational numbers which are not integers.
+func toIntegral(v Value) (Value, bool) {
+	r, ok := v.(Rat)
+	if !ok {
+		return v, true
+	}
+	if !r.IsInt() {
+		return v, false
+	}
+	return fromBig(r.Num())
+}
+
+// ratBits returns the size of the rational number in bits
+func ratBits(r *big.Rat) int {
+	return r.Num().BitLen() + r.Denom().BitLen()
+}
+
+// powRat computes x^y for integer exponents. The result is set to a value
+// exceeding the size limit if it would be too large to compute.
+func powRat(z, x, y *big.Rat) bool {
+	if !y.IsInt() {
+		return false
+	}
+	n := y.Num()
+	if x.Sign() == 0 && n.Sign() < 0 {
+		return false
+	}
+	trivial := x.Sign() == 0 || x.Num().CmpAbs(x.Denom()) == 0
+	if !trivial && (!n.IsInt64() || float64(ratBits(x))*math.Abs(float64(n.Int64())) > 2*maxBigIntBits) {
+		z.SetInt(new(big.Int).Lsh(big.NewInt(1), maxBigIntBits))
+		return true
+	}
+	e := new(big.Int).Abs(n)
+	num := new(big.Int).Exp(x.Num(), e, nil)
+	den := new(big.Int).Exp(x.Denom(), e, nil)
+	if n.Sign() < 0 {
+		num, den = den, num
+	}
+	z.SetFrac(num, den)
+	return true
+}
@@ -0,0 +1,101 @@
+package ast
+
+// Scope holds the variables and functions visible to a program. Scopes may
+// be nested, in which case names are resolved from the innermost scope out.
+type Scope struct {
+	parent *Scope
+	vars   map[string]*Variable
+	funcs  map[string]*Function
+	slots  *int
+}
+
+// NewScope returns a new empty scope
+func NewScope() *Scope {
+	return &Scope{
+		vars:  make(map[string]*Variable),
+		funcs: make(map[string]*Function),
+		slots: new(int),
+	}
+}
+
+// Child returns a new empty scope nested in the scope
+func (s *Scope) Child() *Scope {
+	c := NewScope()
+	c.parent = s
+	c.slots = s.slots
+	return c
+}
+
+// Lookup returns the variable bound to name, or nil if there is none
+func (s *Scope) Lookup(name string) *Variable {
+	for ; s != nil; s = s.parent {
+		if v, ok := s.vars[name]; ok {
+			return v
+		}
+	}
+	return nil
+}
+
+// Define binds name to a new variable, shadowing any previous binding
+func (s *Scope) Define(name string) *Variable {
+	v := &Variable{Name: name, slot: *s.slots}
+	*s.slots++
+	s.vars[name] = v
+	return v
+}
+
+// Declare binds name to a new variable of the given type, whose value is
+// set before evaluation rather than by an assignment
+func (s *Scope) Declare(name string, t Type) *Variable {
+	v := s.Define(name)
+	v.t = t
+	return v
+}
+
+// LookupFunc returns the function bound to name, or nil if there is none
+func (s *Scope) LookupFunc(name string) *Function {
+	for ; s != nil; s = s.parent {
+		if f, ok := s.funcs[name]; ok {
+			return f
+		}
+	}
+	return nil
+}
+
+// DefineFunc binds name to a new function with the given parameters,
+// shadowing any previous binding. The body of the function must be set
+// before it is called.
+func (s *Scope) DefineFunc(name string, params []*Variable) *Function {
+	f := &Function{Name: name, Params: params}
+	s.funcs[name] = f
+	return f
+}
+
+// Clone returns a copy of the scope. Variables and functions defined in the
+// copy are not visible in the original scope.
+func (s *Scope) Clone() *Scope {
+	c := NewScope()
+	c.parent = s.parent
+	c.slots = s.slots
+	for k, v := range s.vars {
+		c.vars[k] = v
+	}
+	for k, f := range s.funcs {
+		c.funcs[k] = f
+	}
+	return c
+}
+
+// Variable is a binding of a name to the value of an expression. The type
+// of the variable is known once the assigned expression has been analyzed,
+// while the value is held by the environment of the evaluation.
+type Variable struct {
+	Name string
+	t    Type
+	slot int
+}
+
+// Type returns the type of the variable
+func (v *Variable) Type() Type {
+	return v.t
+}
@@ -1,12 +1,69 @@
 package ast
 
-import "github.com/tympanix/gocalc/debug"
+import (
+	"math"
+	"math/big"
+
+	"github.com/tympanix/gocalc/debug"
+	"github.com/tympanix/gocalc/diag"
+)
+
+type unaryAnalyzer func(*unaryExp) error
+
+// defaultUnaryAnalyzer checks that the operand is a number
+var defaultUnaryAnalyzer = func(u *unaryExp) error {
+	var errs diag.List
+	errs.Append(u.param.Analyze())
+	if !numeric(u.param.Type()) {
+		errs.Add(u.Span(), &TypeError{
+			Kind:     IllegalOperands,
+			Span:     u.Span(),
+			Name:     u.name,
+			Operands: []Type{u.param.Type()},
+		})
+	}
+	return errs.Err()
+}
+
+// integerUnaryAnalyzer checks that the operand is an integer
+var integerUnaryAnalyzer = func(u *unaryExp) error {
+	var errs diag.List
+	errs.Append(u.param.Analyze())
+	if !whole(u.param.Type()) {
+		errs.Add(u.Span(), &TypeError{
+			Kind:     IllegalOperands,
+			Span:     u.Span(),
+			Name:     u.name,
+			Operands: []Type{u.param.Type()},
+		})
+	}
+	return errs.Err()
+}
 
 type unaryExp struct {
 	name  string
 	param Node
+	a     unaryAnalyzer
 	fn    func(float64) float64
-	NopAnalyzer
+	// ints and bigs compute the operation exactly if the operand is an
+	// integer, in 64 bits and with arbitrary precision respectively
+	ints func(integer) integer
+	bigs func(z, x *big.Int) *big.Int
+	// rats computes the operation exactly if the operand is rational
+	rats func(z, x *big.Rat) *big.Rat
+	// bigf computes the operation with arbitrary precision if enabled by
+	// the environment
+	bigf func(z, x *big.Float) *big.Float
+	// cmplx computes the operation if the operand is complex
+	cmplx func(complex128) complex128
+	// integral is set if the operand must be an integer
+	integral bool
+	Location
+}
+
+// Analyze checks the operand
+func (u *unaryExp) Analyze() error {
+	return u.a(u)
 }
 
 func (u *unaryExp) Print() {
@@ -16,8 +73,42 @@ func (u *unaryExp) Print() {
 	debug.Outdent()
 }
 
-func (u *unaryExp) Calc() float64 {
-	return u.fn(u.param.Calc())
+func (u *unaryExp) Calc(env *Env) (Value, error) {
+	v, err := u.param.Calc(env)
+	if err != nil {
+		return nil, err
+	}
+	if u.integral {
+		var ok bool
+		if v, ok = toIntegral(v); !ok {
+			return env.fail(u, DomainError, u.name, math.NaN())
+		}
+	}
+	if v.Type() == INTEGER && u.ints != nil {
+		if i, ok := toInteger(v); ok {
+			if r, ok := u.ints(i).value(); ok {
+				return r, nil
+			}
+		}
+		if x, ok := toBig(v); ok && env.Integers == BigIntegers {
+			if r, ok := fromBig(u.bigs(new(big.Int), x)); ok {
+				return r, nil
+			}
+		}
+		if !env.IEEE {
+			return nil, &RuntimeError{Kind: Overflow, Span: u.Span(), Name: u.name}
+		}
+	}
+	if c, ok := v.(Complex); ok && u.cmplx != nil {
+		return Complex(u.cmplx(complex128(c))), nil
+	}
+	if r, ok := v.(Rat); ok && u.rats != nil {
+		return Rat{u.rats(new(big.Rat), r.Rat)}, nil
+	}
+	if x, ok := toBigFloat(v, env.Precision); ok && env.Precision > 0 && u.bigf != nil {
+		return BigFloat{u.bigf(newFloat(env.Precision), x)}, nil
+	}
+	return Float(u.fn(ToFloat(v))), nil
 }
 
 func (u *unaryExp) Type() Type {
@@ -29,8 +120,32 @@ func NewNegOp(param Node) Node {
 	return &unaryExp{
 		name:  "-",
 		param: param,
+		a:     defaultUnaryAnalyzer,
 		fn: func(a float64) float64 {
 			return -a
 		},
+		ints: integer.negate,
+		bigs: (*big.Int).Neg,
+		rats: (*big.Rat).Neg,
+		bigf: (*big.Float).Neg,
+		cmplx: func(a complex128) complex128 {
+			return -a
+		},
+	}
+}
+
+// NewBitwiseNotOp returns the AST node for the bitwise complement (~)
+// operator
+func NewBitwiseNotOp(param Node) Node {
+	return &unaryExp{
+		name:     "~",
+		param:    param,
+		a:        integerUnaryAnalyzer,
+		integral: true,
+		fn: func(a float64) float64 {
+			return float64(^int64(a))
+		},
+		ints: integer.complement,
+		bigs: (*big.Int).Not,
 	}
 }
@@ -0,0 +1,121 @@
+package ast
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// Value is the result of evaluating a node
+type Value interface {
+	Type() Type
+	String() string
+}
+
+// Float is a value of type FLOAT
+type Float float64
+
+// Type returns the float type
+func (f Float) Type() Type {
+	return FLOAT
+}
+
+// String returns the shortest representation of the float
+func (f Float) String() string {
+	return strconv.FormatFloat(float64(f), 'g', -1, 64)
+}
+
+// Int is a value of type INTEGER
+type Int int64
+
+// Type returns the integer type
+func (i Int) Type() Type {
+	return INTEGER
+}
+
+// String returns the decimal representation of the integer
+func (i Int) String() string {
+	return strconv.FormatInt(int64(i), 10)
+}
+
+// Uint is a value of type INTEGER which is too large to be an Int
+type Uint uint64
+
+// Type returns the integer type
+func (u Uint) Type() Type {
+	return INTEGER
+}
+
+// String returns the decimal representation of the integer
+func (u Uint) String() string {
+	return strconv.FormatUint(uint64(u), 10)
+}
+
+// Bool is a value of type BOOLEAN
+type Bool bool
+
+// Type returns the boolean type
+func (b Bool) Type() Type {
+	return BOOLEAN
+}
+
+// String returns true or false
+func (b Bool) String() string {
+	return strconv.FormatBool(bool(b))
+}
+
+// Format denotes the textual representation of values
+type Format struct {
+	Rat     RatFormat
+	Complex ComplexFormat
+}
+
+// FormatValue returns the textual representation of the value in the given
+// format
+func FormatValue(v Value, f Format) string {
+	switch v := v.(type) {
+	case Rat:
+		return v.Text(f.Rat)
+	case Complex:
+		return v.Text(f.Complex)
+	case nil:
+		return ""
+	}
+	return v.String()
+}
+
+// ToFloat returns the value converted to a float64
+func ToFloat(v Value) float64 {
+	switch v := v.(type) {
+	case Float:
+		return float64(v)
+	case Int:
+		return float64(v)
+	case Uint:
+		return float64(v)
+	case BigInt:
+		f, _ := new(big.Float).SetInt(v.Int).Float64()
+		return f
+	case BigFloat:
+		f, _ := v.Float64()
+		return f
+	case Rat:
+		f, _ := v.Float64()
+		return f
+	case Complex:
+		if imag(v) == 0 {
+			return real(v)
+		}
+	}
+	return math.NaN()
+}
+
+// finite reports whether none of the floats are NaN or infinite
+func finite(a ...float64) bool {
+	for _, f := range a {
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return false
+		}
+	}
+	return true
+}
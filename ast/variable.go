@@ -0,0 +1,71 @@
+package ast
+
+import "github.com/tympanix/gocalc/debug"
+
+type variableExp struct {
+	v *Variable
+	NopAnalyzer
+	Location
+}
+
+// Calc returns the value of the variable in the environment
+func (e *variableExp) Calc(env *Env) (Value, error) {
+	v := env.Get(e.v)
+	if v == nil {
+		return nil, &RuntimeError{Kind: UnboundVariable, Span: e.Span(), Name: e.v.Name}
+	}
+	return v, nil
+}
+
+func (e *variableExp) Print() {
+	debug.Println(e.v.Name)
+}
+
+func (e *variableExp) Type() Type {
+	return e.v.Type()
+}
+
+// NewVariableExp returns the AST node for a reference to a variable
+func NewVariableExp(v *Variable) Node {
+	return &variableExp{v: v}
+}
+
+type assignExp struct {
+	v   *Variable
+	exp Node
+	Location
+}
+
+// Analyze analyzes the assigned expression and types the variable from it
+func (a *assignExp) Analyze() error {
+	err := a.exp.Analyze()
+	a.v.t = a.exp.Type()
+	return err
+}
+
+// Calc evaluates the assigned expression and stores the result in the variable
+func (a *assignExp) Calc(env *Env) (Value, error) {
+	value, err := a.exp.Calc(env)
+	if err != nil {
+		return nil, err
+	}
+	env.Set(a.v, value)
+	return value, nil
+}
+
+func (a *assignExp) Print() {
+	debug.Println("=")
+	debug.Indent()
+	debug.Println(a.v.Name)
+	a.exp.Print()
+	debug.Outdent()
+}
+
+func (a *assignExp) Type() Type {
+	return a.exp.Type()
+}
+
+// NewAssignExp returns the AST node for assigning an expression to a variable
+func NewAssignExp(v *Variable, exp Node) Node {
+	return &assignExp{v: v, exp: exp}
+}
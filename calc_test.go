@@ -1,43 +1,71 @@
-package main
+package gocalc
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
+	"math/big"
+	"math/bits"
 	"os"
 	"path"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 
+	"github.com/tympanix/gocalc/ast"
+	"github.com/tympanix/gocalc/diag"
 	"github.com/tympanix/gocalc/parser"
 	"github.com/tympanix/gocalc/scanner"
+	"github.com/tympanix/gocalc/scanner/token"
 )
 
 const (
 	result  = "result:"
+	failure = "error:"
 	margin  = 1e-5
 	passDir = "./test/pass"
+	failDir = "./test/fail"
 )
 
-func getResult(path string) (float64, error) {
+func getComments(path string, key string) ([]string, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
+	defer f.Close()
 	r := bufio.NewScanner(f)
 
+	var comments []string
 	for r.Scan() {
-		if i := strings.Index(r.Text(), result); i > -1 {
-			s := strings.TrimSpace(r.Text()[i+len(result):])
-			r, err := strconv.ParseFloat(s, 64)
-			if err != nil {
-				return 0, err
-			}
-			return r, nil
+		if i := strings.Index(r.Text(), key); i > -1 {
+			comments = append(comments, strings.TrimSpace(r.Text()[i+len(key):]))
 		}
 	}
-	return 0, fmt.Errorf("missing result for file: %s", f.Name())
+	if len(comments) == 0 {
+		return nil, fmt.Errorf("missing %s for file: %s", strings.TrimSuffix(key, ":"), f.Name())
+	}
+	return comments, nil
+}
+
+func getComment(path string, key string) (string, error) {
+	c, err := getComments(path, key)
+	if err != nil {
+		return "", err
+	}
+	return c[0], nil
+}
+
+func getResult(path string) (float64, error) {
+	s, err := getComment(path, result)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(s, 64)
 }
 
 func TestPass(t *testing.T) {
@@ -81,9 +109,13 @@ func TestPass(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			r := n.Calc()
+			v, err := n.Calc(ast.NewEnv(context.Background()))
 
-			if r > res+margin || r < res-margin {
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if r := ast.ToFloat(v); r > res+margin || r < res-margin {
 				t.Errorf("result: %f, expected: %f", r, res)
 			}
 
@@ -93,6 +125,1328 @@ func TestPass(t *testing.T) {
 
 }
 
+func TestFail(t *testing.T) {
+
+	files, err := ioutil.ReadDir(failDir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range files {
+
+		t.Run(f.Name(), func(t *testing.T) {
+			path := path.Join(failDir, f.Name())
+
+			s, err := scanner.NewFromFile(path)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected, err := getComments(path, failure)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			n, err := parser.New(s).Parse()
+
+			if err == nil {
+				err = n.Analyze()
+			}
+
+			var errs diag.List
+
+			if !errors.As(err, &errs) {
+				t.Fatalf("expected errors: %s, got: %v", strings.Join(expected, ", "), err)
+			}
+
+			src, err := ioutil.ReadFile(path)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, d := range errs {
+				if d.Span.Excerpt(string(src)) == "" {
+					t.Errorf("missing excerpt for error: %s", d)
+				}
+				if i >= len(expected) {
+					t.Errorf("unexpected error: %s", d)
+				} else if d.Error() != expected[i] {
+					t.Errorf("error: %s, expected: %s", d, expected[i])
+				}
+			}
+
+			for i := len(errs); i < len(expected); i++ {
+				t.Errorf("missing error: %s", expected[i])
+			}
+		})
+
+	}
+
+}
+
+func TestErrorTypes(t *testing.T) {
+	tests := []struct {
+		input  string
+		target interface{}
+	}{
+		{"1 $ 2", new(*scanner.Error)},
+		{"(1 + 2", new(*parser.SyntaxError)},
+		{"foo(2)", new(*parser.SyntaxError)},
+		{"1.5 % 2", new(*ast.TypeError)},
+	}
+
+	for _, test := range tests {
+		n, err := parser.New(scanner.NewFromString(test.input)).Parse()
+
+		if err == nil {
+			err = n.Analyze()
+		}
+
+		if !errors.As(err, test.target) {
+			t.Errorf("%s: unexpected error: %v", test.input, err)
+		}
+	}
+}
+
+func TestScope(t *testing.T) {
+	scope := ast.NewScope()
+	env := ast.NewEnv(context.Background())
+
+	for _, line := range []string{"x = 3 * pi", "y = x / 3", "x * y"} {
+		n, err := parser.NewWithScope(scanner.NewFromString(line), scope).Parse()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := n.Analyze(); err != nil {
+			t.Fatal(err)
+		}
+
+		v, err := n.Calc(env)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if r := ast.ToFloat(v); line == "x * y" && math.Abs(r-3*math.Pi*math.Pi) > margin {
+			t.Errorf("result: %f, expected: %f", r, 3*math.Pi*math.Pi)
+		}
+	}
+
+	if v := scope.Lookup("y"); v == nil || v.Type() != ast.FLOAT {
+		t.Errorf("expected variable y of type FLOAT")
+	}
+}
+
+func TestRecursionLimit(t *testing.T) {
+	n, err := parser.New(scanner.NewFromString("f(x) = f(x + 1); f(0)")).Parse()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.Analyze(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = n.Calc(ast.NewEnv(context.Background()))
+
+	if !errors.Is(err, ast.ErrMaxCallDepth) {
+		t.Errorf("error: %v, expected: %v", err, ast.ErrMaxCallDepth)
+	}
+}
+
+func TestFunction(t *testing.T) {
+	tests := []struct {
+		src    string
+		t      ast.Type
+		result string
+	}{
+		{"fact(n) = n <= 1 ? 1 : n * fact(n - 1); fact(20)", ast.INTEGER, "2432902008176640000"},
+		{"fib(n) = n < 2 ? n : fib(n - 1) + fib(n - 2); fib(20)", ast.INTEGER, "6765"},
+		{"even(n) = n == 0 ? 1 < 2 : !even(n - 1); even(7)", ast.BOOLEAN, "false"},
+		{"h(x) = x > 1 ? h(x / 2) : x; h(10)", ast.RATIONAL, "5/8"},
+		{"h(x) = x > 1 ? h(x / 2) : x; h(10.0)", ast.FLOAT, "0.625"},
+		{"f(x) = 2x; g(x) = f(x) + f(x / 2); g(3)", ast.RATIONAL, "9"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			v, err := Eval(test.src)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if v.String() != test.result || v.Type() != test.t {
+				t.Errorf("result: %s (%s), expected: %s (%s)", v, v.Type(), test.result, test.t)
+			}
+		})
+	}
+
+	// the body of every function is analyzed once for each type of argument
+	src := "f0(x) = x + 1\n"
+	for i := 1; i <= 40; i++ {
+		src += fmt.Sprintf("f%d(x) = f%d(x) + f%d(x)\n", i, i-1, i-1)
+	}
+	if _, err := Compile(src + "1 > 2 ? f40(1.5) : f40(1)"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRuntimeError(t *testing.T) {
+	tests := []struct {
+		src  string
+		kind ast.RuntimeErrorKind
+		pos  string
+		ieee float64
+	}{
+		{"1 + 2 / 0", ast.DivisionByZero, "1:5", math.Inf(1)},
+		{"5 % (2 - 2)", ast.DivisionByZero, "1:1", math.NaN()},
+		{"0^-1", ast.DivisionByZero, "1:1", math.Inf(1)},
+		{"x = 0.0; x^-2.5", ast.DivisionByZero, "1:10", math.Inf(1)},
+		{"(1/2 - 1/2)^-3", ast.DivisionByZero, "1:2", math.Inf(1)},
+		{"(2^64) % 3", ast.Overflow, "1:2", 1},
+		{"-(2^63 + 2^62) % 2^62", ast.Overflow, "1:1", 0},
+		{"sqrt(-1)", ast.DomainError, "1:1", math.NaN()},
+		{"log(0)", ast.DomainError, "1:1", math.Inf(-1)},
+		{"f(x) = x * 1e300; f(1e300)", ast.Overflow, "1:8", math.Inf(1)},
+		{"0xFFFFFFFFFFFFFFFF + 1", ast.Overflow, "1:1", 1 << 64},
+		{"-2^63 - 1", ast.Overflow, "1:1", -(1 << 63) - 1},
+		{"-0xFFFFFFFFFFFFFFFF", ast.Overflow, "1:1", -(1 << 64)},
+		{"3 ^ 41", ast.Overflow, "1:1", math.Pow(3, 41)},
+		{"1 << 64", ast.Overflow, "1:1", 1 << 64},
+		{"1 << -1", ast.DomainError, "1:1", math.NaN()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			n, err := parser.New(scanner.NewFromString(test.src)).Parse()
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := n.Analyze(); err != nil {
+				t.Fatal(err)
+			}
+
+			env := ast.NewEnv(context.Background())
+			_, err = n.Calc(env)
+
+			var rerr *ast.RuntimeError
+			if !errors.As(err, &rerr) {
+				t.Fatalf("error: %v, expected runtime error", err)
+			}
+
+			if rerr.Kind != test.kind || rerr.Span.Start.String() != test.pos {
+				t.Errorf("error: %v, expected kind %d at %s", err, test.kind, test.pos)
+			}
+
+			env.IEEE = true
+			v, err := n.Calc(env)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if r := ast.ToFloat(v); r != test.ieee && !(math.IsNaN(r) && math.IsNaN(test.ieee)) {
+				t.Errorf("result: %f, expected: %f", r, test.ieee)
+			}
+		})
+	}
+}
+
+func TestInteger(t *testing.T) {
+	tests := []struct {
+		src    string
+		result string
+		t      ast.Type
+	}{
+		{"0xFFFFFFFFFFFFFFFF", "18446744073709551615", ast.INTEGER},
+		{"2^60 + 1", "1152921504606846977", ast.INTEGER},
+		{"2^63", "9223372036854775808", ast.INTEGER},
+		{"-2^63", "-9223372036854775808", ast.INTEGER},
+		{"0xFFFFFFFFFFFFFFFF - 2^63 - 2^63", "-1", ast.INTEGER},
+		{"0xFFFFFFFFFFFFFFFF & 0xF0F0", "61680", ast.INTEGER},
+		{"0xFFFFFFFFFFFFFFFF # 1", "18446744073709551614", ast.INTEGER},
+		{"-1 & 0xFF", "255", ast.INTEGER},
+		{"-16 | 3", "-13", ast.INTEGER},
+		{"-7 % 3", "-1", ast.INTEGER},
+		{"1 << 63", "9223372036854775808", ast.INTEGER},
+		{"-1 << 63", "-9223372036854775808", ast.INTEGER},
+		{"-5 >> 1", "-3", ast.INTEGER},
+		{"1 >> 64", "0", ast.INTEGER},
+		{"-1 >>> 1", "9223372036854775807", ast.INTEGER},
+		{"-1 >>> 0", "18446744073709551615", ast.INTEGER},
+		{"~5", "-6", ast.INTEGER},
+		{"~0xFFFFFFFFFFFFFFFF", "0", ast.INTEGER},
+		{"3 * -5", "-15", ast.INTEGER},
+		{"2^-1", "1/2", ast.RATIONAL},
+		{"x = 2; 3^x", "9", ast.INTEGER},
+		{"2^(1+1) & 1", "0", ast.INTEGER},
+		{"x = 2; 3^x & 1", "1", ast.INTEGER},
+		{"f(n) = 2^n | 1; f(3)", "9", ast.INTEGER},
+		{"x = 2^-1 * 4; x << 1", "4", ast.INTEGER},
+		{"3 * 2.5", "7.5", ast.FLOAT},
+	}
+
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			v, err := Eval(test.src)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if v.String() != test.result || v.Type() != test.t {
+				t.Errorf("result: %s (%s), expected: %s (%s)", v, v.Type(), test.result, test.t)
+			}
+		})
+	}
+
+	// a power with a negative exponent is not an integer
+	for _, src := range []string{"(2^-1) & 1", "(2^-1) % 2", "x = 2^-1; x & 1", "n = -1; (2^n) << 1", "~(2^-1)"} {
+		var rerr *ast.RuntimeError
+		if _, err := Eval(src); !errors.As(err, &rerr) || rerr.Kind != ast.DomainError {
+			t.Errorf("%s: error: %v, expected domain error", src, err)
+		}
+	}
+}
+
+func TestBigInteger(t *testing.T) {
+	tests := []struct {
+		src    string
+		result string
+		fixed  bool // whether the result can be computed in 64 bits
+	}{
+		{"2^200", "1606938044258990275541962092341162602522202993782792835301376", false},
+		{"factorial(50)", "30414093201713378043612608166064768844377641568960512000000000000", false},
+		{"factorial(20)", "2432902008176640000", true},
+		{"0x10000000000000000 - 1", "18446744073709551615", false},
+		{"-0xFFFFFFFFFFFFFFFF - 1", "-18446744073709551616", false},
+		{"(2^100 + 7) % 2^64", "7", false},
+		{"2^100 & (2^101 - 1) | 1", "1267650600228229401496703205377", false},
+		{"2^64 # -1", "-18446744073709551617", false},
+		{"1 << 100 | 1", "1267650600228229401496703205377", false},
+		{"(1 << 100) >> 98", "4", true},
+		{"-(1 << 100) >> 200", "-1", true},
+		{"~(1 << 64)", "-18446744073709551617", false},
+		{"2^64 * 3 - 2^65 - 2^64 + 5", "5", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			e, err := Compile(test.src)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			v, err := e.Eval(nil, BigIntegers())
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if v.String() != test.result || v.Type() != ast.INTEGER {
+				t.Errorf("result: %s (%s), expected: %s", v, v.Type(), test.result)
+			}
+
+			var rerr *ast.RuntimeError
+			if _, err := e.Eval(nil); !test.fixed && (!errors.As(err, &rerr) || rerr.Kind != ast.Overflow) {
+				t.Errorf("error: %v, expected overflow in 64 bits", err)
+			}
+		})
+	}
+
+	for _, src := range []string{"factorial(-1)", "factorial(2^64)", "2^(2^40)"} {
+		if _, err := MustCompile(src).Eval(nil, BigIntegers()); err == nil {
+			t.Errorf("%s: expected error", src)
+		}
+	}
+}
+
+func TestRational(t *testing.T) {
+	tests := []struct {
+		src     string
+		t       ast.Type
+		results [3]string // fraction, mixed and decimal
+	}{
+		{"1/3", ast.RATIONAL, [3]string{"1/3", "1/3", "0.3333333333333333"}},
+		{"1/3 + 1/6", ast.RATIONAL, [3]string{"1/2", "1/2", "0.5"}},
+		{"7/3", ast.RATIONAL, [3]string{"7/3", "2 1/3", "2.3333333333333333"}},
+		{"-7/3", ast.RATIONAL, [3]string{"-7/3", "-2 1/3", "-2.3333333333333333"}},
+		{"2/3 * 3/4 - 1", ast.RATIONAL, [3]string{"-1/2", "-1/2", "-0.5"}},
+		{"(2/3)^-2", ast.RATIONAL, [3]string{"9/4", "2 1/4", "2.25"}},
+		{"6/3", ast.RATIONAL, [3]string{"2", "2", "2"}},
+		{"x = 1/3; x * 3", ast.RATIONAL, [3]string{"1", "1", "1"}},
+		{"1/80", ast.RATIONAL, [3]string{"1/80", "1/80", "0.0125"}},
+		{"1/4 + 0.5", ast.FLOAT, [3]string{"0.75", "0.75", "0.75"}},
+		{"(1/4)^0.5", ast.FLOAT, [3]string{"0.5", "0.5", "0.5"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			v, err := Eval(test.src)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if v.Type() != test.t {
+				t.Errorf("type: %s, expected: %s", v.Type(), test.t)
+			}
+
+			for i, f := range []ast.RatFormat{ast.Fraction, ast.Mixed, ast.Decimal} {
+				if r := v.Text(ast.Format{Rat: f}); r != test.results[i] {
+					t.Errorf("result: %s, expected: %s", r, test.results[i])
+				}
+			}
+		})
+	}
+}
+
+func TestComplex(t *testing.T) {
+	tests := []struct {
+		src    string
+		t      ast.Type
+		result string
+		polar  string
+	}{
+		{"(1+2i)*(3-1i)", ast.COMPLEX, "5+5i", "7.0710678118654755∠0.7853981633974483"},
+		{"3i + 2.5j", ast.COMPLEX, "0+5.5i", "5.5∠1.5707963267948966"},
+		{"i^2", ast.COMPLEX, "-1+0i", "1∠3.141592653589793"},
+		{"(1+1i)^-2", ast.COMPLEX, "0-0.5i", "0.5∠-1.5707963267948966"},
+		{"conj(1+2i)", ast.COMPLEX, "1-2i", "2.23606797749979∠-1.1071487177940904"},
+		{"sqrt(-4)", ast.COMPLEX, "0+2i", "2∠1.5707963267948966"},
+		{"ln(-1) / pi", ast.COMPLEX, "0+1i", "1∠1.5707963267948966"},
+		{"re(3+4i)", ast.FLOAT, "3", "3"},
+		{"im(3+4i)", ast.FLOAT, "4", "4"},
+		{"abs(3+4i)", ast.FLOAT, "5", "5"},
+		{"arg(-1)", ast.FLOAT, "3.141592653589793", "3.141592653589793"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			v, err := MustCompile(test.src).Eval(nil, Complex())
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if v.Type() != test.t {
+				t.Errorf("type: %s, expected: %s", v.Type(), test.t)
+			}
+
+			if r := v.String(); r != test.result {
+				t.Errorf("result: %s, expected: %s", r, test.result)
+			}
+
+			if r := v.Text(ast.Format{Complex: ast.Polar}); r != test.polar {
+				t.Errorf("polar: %s, expected: %s", r, test.polar)
+			}
+		})
+	}
+
+	var rerr *ast.RuntimeError
+	if _, err := Eval("sqrt(-4)"); !errors.As(err, &rerr) || rerr.Kind != ast.DomainError {
+		t.Errorf("error: %v, expected domain error without complex results", err)
+	}
+
+	if _, err := Eval("1i / 0"); !errors.As(err, &rerr) || rerr.Kind != ast.DivisionByZero {
+		t.Errorf("error: %v, expected division by zero", err)
+	}
+
+	if _, err := Compile("round(1i)"); err == nil {
+		t.Error("round(1i): expected error for complex argument")
+	}
+}
+
+func TestBoolean(t *testing.T) {
+	tests := []struct {
+		src    string
+		result bool
+	}{
+		{"1 < 2", true},
+		{"2 <= 1", false},
+		{"3 > 2 && 2 > 1", true},
+		{"1 > 2 || 2 >= 3", false},
+		{"!(1 == 2)", true},
+		{"1 < 2 == 2 < 1", false},
+		{"5 & 3 == 1", true},
+		{"1 == 1.0", true},
+		{"0.1 + 0.2 == 0.3", false},
+		{"1/3 + 1/3 == 2/3", true},
+		{"2^53 + 1 > 2.0^53", true},
+		{"1 + 2i != 1 - 2i", true},
+		{"x = 1 < 2; x == (2 > 1)", true},
+		{"1 > 2 && 1/0 > 1", false},
+		{"1 < 2 || 1/0 > 1", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			v, err := Eval(test.src)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if r, ok := v.Bool(); !ok || r != test.result || v.Type() != ast.BOOLEAN {
+				t.Errorf("result: %s (%s), expected: %t", v, v.Type(), test.result)
+			}
+		})
+	}
+
+	for src, result := range map[string]bool{"0/0 == 0/0": false, "0/0 != 0/0": true, "0/0 < 1": false} {
+		v, err := MustCompile(src).Eval(nil, IEEE())
+		if r, _ := v.Bool(); err != nil || r != result {
+			t.Errorf("%s: result: %s, expected: %t", src, v, result)
+		}
+	}
+}
+
+func TestConditional(t *testing.T) {
+	tests := []struct {
+		src    string
+		t      ast.Type
+		result string
+	}{
+		{"1 < 2 ? 1 : 2", ast.INTEGER, "1"},
+		{"1 < 2 ? 1 : 2.5", ast.FLOAT, "1"},
+		{"1 > 2 ? 1 : 1/2", ast.RATIONAL, "1/2"},
+		{"1 < 2 ? 1 : 1i", ast.COMPLEX, "1+0i"},
+		{"if 1 < 2 then 1 < 2 else 2 < 1", ast.BOOLEAN, "true"},
+		{"1 > 2 ? 1 : 2 > 3 ? 2 : 3", ast.INTEGER, "3"},
+		{"1 + if 1 > 2 then 1 else 2 * 3", ast.INTEGER, "7"},
+		{"1 < 2 ? 1 : 1/0", ast.RATIONAL, "1"},
+		{"if 1 > 2 then sqrt(-1) else 0.5", ast.FLOAT, "0.5"},
+		{"piecewise(1 > 2, 1, 2 > 3, 2)", ast.INTEGER, ""},
+		{"piecewise(1 > 2, 1, 2 < 3, 2.5, 3)", ast.FLOAT, "2.5"},
+		{"piecewise(1 > 2, 1, 2 > 3, 2, 3)", ast.INTEGER, "3"},
+		{"f(x) = x > 0 ? x : 0; a = f(2^62+1); b = f(1.5); a", ast.INTEGER, "4611686018427387905"},
+		{"f(x) = x > 0 ? x : 0; a = f(1.5); b = f(2^62+1); a", ast.FLOAT, "1.5"},
+		{"f(x) = piecewise(x > 0, x, 1/2); a = f(3); b = f(1.5); a", ast.RATIONAL, "3"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			v, err := Eval(test.src)
+
+			var rerr *ast.RuntimeError
+			if test.result == "" {
+				if !errors.As(err, &rerr) || rerr.Kind != ast.DomainError {
+					t.Errorf("error: %v, expected domain error", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if v.String() != test.result || v.Type() != test.t {
+				t.Errorf("result: %s (%s), expected: %s (%s)", v, v.Type(), test.result, test.t)
+			}
+		})
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	tests := []struct {
+		src    string
+		result string
+		legacy string
+	}{
+		{"2^3^2", "512", "64"},
+		{"-2^2", "-4", "4"},
+		{"2^-1", "1/2", "1/2"},
+		{"-2^-2", "-1/4", "1/4"},
+		{"2 * 3^2", "18", "18"},
+		{"2^3 * 2", "16", "16"},
+		{"8 / 2 / 2", "2", "2"},
+		{"2 - 3 - 4", "-5", "-5"},
+		{"1 + 2 * 3", "7", "7"},
+		{"7 - 6 / 3", "5", "5"},
+		{"7 % 4 * 2", "6", "6"},
+		{"1 + 7 % 4", "4", "4"},
+		{"- -2", "2", "2"},
+		{"1 - -2^2", "5", "-3"},
+		{"1 + 2 & 7", "3", "3"},
+		{"6 & 3 # 1", "3", "3"},
+		{"6 # 3 | 1", "5", "5"},
+		{"1 | 2 # 3 & 1", "3", "3"},
+		{"1 | 2 < 4", "true", "true"},
+		{"1 << 2 + 1", "8", "8"},
+		{"1 << 2 & 7", "4", "4"},
+		{"32 >> 2 >> 1", "4", "4"},
+		{"~1 + 1", "-1", "-1"},
+		{"-2 ** 2", "-4", "4"},
+		{"2 ** 3 ** 2", "512", "64"},
+		{"1 < 2 == 2 < 3", "true", "true"},
+		{"1 == 2 && 3 == 3 || 1 < 2", "true", "true"},
+		{"1 < 2 || 1 < 2 && 1 > 2", "true", "true"},
+		{"!(1 < 2) || 2 > 1", "true", "true"},
+		{"1 < 2 || 1 > 2 ? 1 : 2", "1", "1"},
+		{"1 > 2 ? 1 : 2 > 3 ? 2 : 3", "3", "3"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			for _, legacy := range []bool{false, true} {
+				expected := test.result
+				opts := []Option{}
+				if legacy {
+					expected = test.legacy
+					opts = append(opts, WithLegacyPrecedence())
+				}
+
+				v, err := Eval(test.src, opts...)
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if v.String() != expected {
+					t.Errorf("result: %s, expected: %s (legacy: %t)", v, expected, legacy)
+				}
+			}
+		})
+	}
+}
+
+func TestPrecision(t *testing.T) {
+	const (
+		pi    = "3.14159265358979323846264338327950288419716939937510582097494459230781640628620899862803482534211706798"
+		e     = "2.71828182845904523536028747135266249775724709369995957496696762772407663035354759457138217852516642742746"
+		sqrt2 = "1.41421356237309504880168872420969807856967187537694807317667973799073247846210703885038753432764157"
+		ln2   = "0.693147180559945309417232121458176568075500134360255254120680009493393621969694715605863326996418687542"
+		sin1  = "0.841470984807896506652502321630298999622563060798371065672751709991910404391239668948639743543052695"
+	)
+
+	tests := []struct {
+		src    string
+		result string
+	}{
+		{"pi", pi},
+		{"e", e},
+		{"exp(1)", e},
+		{"sqrt(2)", sqrt2},
+		{"2^0.5", sqrt2},
+		{"pow(2, 0.5)", sqrt2},
+		{"ln(2)", ln2},
+		{"-ln(0.5)", ln2},
+		{"log2(8)", "3"},
+		{"log(1000)", "3"},
+		{"sin(1)", sin1},
+		{"sin(1 + 2 * pi)", sin1},
+		{"cos(pi)", "-1"},
+		{"tan(pi / 4)", "1"},
+		{"4 * atan(1)", pi},
+		{"2 * asin(1)", pi},
+		{"3 * acos(0.5)", pi},
+		{"0.1 + 0.2 - 0.3", "0"},
+		{"1 / 3 * 3", "1"},
+		{"deg(pi)", "180"},
+		{"rad(180)", pi},
+		{"round(2.5) - floor(-1.5) + ceil(1.25)", "7"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			v, err := MustCompile(test.src).Eval(nil, Precision(256))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r, ok := v.BigFloat()
+			if !ok {
+				t.Fatalf("result: %s, expected a finite float", v)
+			}
+
+			expected, _, _ := big.ParseFloat(test.result, 10, 256, big.ToNearestEven)
+			diff := new(big.Float).Sub(r, expected)
+			if diff.Sign() != 0 && diff.Abs(diff).MantExp(nil) > expected.MantExp(nil)-240 {
+				t.Errorf("result: %s, expected: %s", v, test.result)
+			}
+		})
+	}
+
+	if v, err := MustCompile("1.0 / 3").Eval(nil, Precision(256)); err != nil || len(v.String()) < 70 {
+		t.Errorf("result: %s, expected %d bits of precision", v, 256)
+	}
+
+	for src, text := range map[string]string{
+		"tan(pi / 4)":   "1",
+		"cos(pi / 3)":   "0.5",
+		"exp(-300000)":  "4.52302537736869338168154543856941208987901785730658877589102779454404342317e-130289",
+		"-exp(300000)":  "-2.21090954962043147554031964344003334958746533182776533253160702399084245726e+130288",
+		"exp(-3000)":    "1.30783901892125043787985918145100203355767160390678660729003584440211024524e-1303",
+		"2^0.5 * 2^0.5": "2",
+	} {
+		if v, err := MustCompile(src).Eval(nil, Precision(256)); err != nil || v.String() != text {
+			t.Errorf("%s: result: %s, error: %v, expected: %s", src, v, err, text)
+		}
+	}
+
+	var rerr *ast.RuntimeError
+	for _, src := range []string{"sqrt(-1)", "ln(0)", "1 / 0", "asin(2)", "(-8)^(1/3)"} {
+		if _, err := MustCompile(src).Eval(nil, Precision(128)); !errors.As(err, &rerr) {
+			t.Errorf("%s: error: %v, expected runtime error", src, err)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	e, err := Compile("hyp(x, y) = sqrt(x^2 + y^2); hyp(x, y) * k",
+		WithVars("x", "y"),
+		WithConst("k", 2),
+		WithFunc("hypot", 2, func(args []float64) float64 {
+			return math.Hypot(args[0], args[1])
+		}),
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, env := range []Env{{"x": 3, "y": 4}, {"x": 5, "y": 12}} {
+		v, err := e.Eval(env)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if r := 2 * math.Hypot(env["x"], env["y"]); v.Float64() != r {
+			t.Errorf("result: %s, expected: %f", v, r)
+		}
+	}
+
+	if _, err := e.Eval(Env{"x": 1}); err == nil {
+		t.Errorf("expected error for unbound variable")
+	}
+
+	if v, err := Eval("hypot(6, 8)", WithFunc("hypot", 2, func(args []float64) float64 {
+		return math.Hypot(args[0], args[1])
+	})); err != nil || v.String() != "10" {
+		t.Errorf("result: %s, expected: 10 (%v)", v, err)
+	}
+
+	if _, err := Eval("1 +"); err == nil {
+		t.Errorf("expected syntax error")
+	}
+
+	for _, src := range []string{"", "// nothing", "f(x) = 2x", "x = 1; f(x) = 2x"} {
+		if v, err := Eval(src); !errors.Is(err, ErrNoResult) {
+			t.Errorf("%q: result: %s, error: %v, expected: %v", src, v, err, ErrNoResult)
+		}
+	}
+}
+
+func TestEvalEnv(t *testing.T) {
+	e := MustCompile("f(n) = n * 2; f(x) + sin(90)", WithVars("x"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(x float64) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				v, err := e.Eval(Env{"x": x}, Angle(ast.Degrees))
+				if err != nil || v.Float64() != 2*x+1 {
+					t.Errorf("result: %s, expected: %f (%v)", v, 2*x+1, err)
+					return
+				}
+			}
+		}(float64(i))
+	}
+	wg.Wait()
+
+	fib := MustCompile("fib(n) = fib(n - 1) + fib(n - 2); fib(1)")
+
+	if _, err := fib.Eval(nil, MaxCalls(100)); !errors.Is(err, ast.ErrMaxCalls) {
+		t.Errorf("error: %v, expected: %v", err, ast.ErrMaxCalls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := fib.Eval(nil, Context(ctx)); !errors.Is(err, context.Canceled) {
+		t.Errorf("error: %v, expected: %v", err, context.Canceled)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	reg := parser.NewRegistry()
+	reg.RegisterFunc("max", ast.Signature{
+		Params:   []ast.Type{ast.FLOAT, ast.FLOAT},
+		Variadic: true,
+		Result:   ast.FLOAT,
+	}, func(args []float64) float64 {
+		m := args[0]
+		for _, a := range args[1:] {
+			m = math.Max(m, a)
+		}
+		return m
+	})
+	reg.RegisterFunc("popcount", ast.Signature{
+		Params: []ast.Type{ast.INTEGER},
+		Result: ast.INTEGER,
+	}, func(args []float64) float64 {
+		return float64(bits.OnesCount64(uint64(args[0])))
+	})
+	reg.RegisterFunc("half", ast.Signature{
+		Params: []ast.Type{ast.INTEGER},
+		Result: ast.INTEGER,
+	}, func(args []float64) float64 {
+		return args[0] / 2
+	})
+	reg.RegisterFunc("third", ast.Signature{
+		Params: []ast.Type{ast.RATIONAL},
+		Result: ast.RATIONAL,
+	}, func(args []float64) float64 {
+		return args[0] / 3
+	})
+	reg.RegisterConst("answer", ast.INTEGER, 42)
+	reg.RemoveFunc("sqrt")
+
+	for _, sig := range []ast.Signature{
+		{Variadic: true, Result: ast.FLOAT},
+		{Params: []ast.Type{ast.COMPLEX}, Result: ast.FLOAT},
+		{Params: []ast.Type{ast.FLOAT}, Result: ast.BOOLEAN},
+	} {
+		if err := reg.RegisterFunc("h", sig, func(args []float64) float64 { return 0 }); err == nil {
+			t.Errorf("%+v: expected invalid signature", sig)
+		}
+	}
+
+	tests := []struct {
+		input  string
+		result float64
+		err    bool
+	}{
+		{"max(1, 7, 3) + answer", 49, false},
+		{"max(1)", 1, false},
+		{"max()", 0, true},
+		{"popcount(answer) & 1", 1, false},
+		{"popcount(2.5)", 0, true},
+		{"popcount(2^53 + 1)", 0, true},
+		{"popcount(2^53) & 1", 1, false},
+		{"half(4) & 3", 2, false},
+		{"half(3)", 0, true},
+		{"third(3/4)", 0.25, false},
+		{"third(1/3)", 0, true},
+		{"sqrt(4)", 0, true},
+	}
+
+	for _, test := range tests {
+		v, err := Eval(test.input, WithRegistry(reg))
+
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected error", test.input)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %v", test.input, err)
+		} else if v.Float64() != test.result {
+			t.Errorf("%s: result: %s, expected: %f", test.input, v, test.result)
+		}
+	}
+
+	if _, err := Eval("sqrt(4)"); err != nil {
+		t.Errorf("registry changes must not affect other parsers: %v", err)
+	}
+
+	if _, err := Eval("pi", Without("pi")); err == nil {
+		t.Errorf("expected error for removed constant")
+	}
+}
+
+func TestImplicit(t *testing.T) {
+	tests := []struct {
+		src    string
+		result string
+		high   string // result with implicit multiplication binding tighter
+	}{
+		{"2pi == 2 * pi", "true", "true"},
+		{"3(1 + 1)", "6", "6"},
+		{"(1 + 2)(3 - 1)", "6", "6"},
+		{"2 sqrt(4)", "4", "4"},
+		{"x = 3; 2x^2", "18", "18"},
+		{"x = 3; x(x + 1)", "12", "12"},
+		{"x = 3; y = 2; x y", "6", "6"},
+		{"-2(3)", "-6", "-6"},
+		{"2(3)(4)", "24", "24"},
+		{"1/2(4)", "2", "1/8"},
+		{"6 / 2(1 + 2)", "9", "1"},
+		{"f(x) = 2x; f(3)", "6", "6"},
+		{"2 e == 2 * e", "true", "true"},
+		{"2exp(1) == 2 * e", "true", "true"},
+		{"2e2", "200", "200"},
+		{"2e-1 == 0.2", "true", "true"},
+		{"2E+1 == 20", "true", "true"},
+		{"1 < 2 ? 2(3) : 0", "6", "6"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			for _, high := range []bool{false, true} {
+				expected := test.result
+				var opts []Option
+				if high {
+					expected = test.high
+					opts = append(opts, WithImplicitPrecedence(parser.PrecImplicit))
+				}
+
+				v, err := Eval(test.src, opts...)
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if v.String() != expected {
+					t.Errorf("result: %s, expected: %s (high: %t)", v, expected, high)
+				}
+			}
+		})
+	}
+
+	for _, src := range []string{"2 3", "e2", "x = 2; x 2", "sqrt 2"} {
+		if _, err := Eval(src); err == nil {
+			t.Errorf("%s: expected error", src)
+		}
+	}
+
+	if _, err := Eval("2pi", WithImplicitPrecedence(0)); err == nil {
+		t.Error("2pi: expected error with implicit multiplication disabled")
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	tests := []struct {
+		src    string
+		result string
+	}{
+		{"π == pi", "true"},
+		{"2π == 2 * pi", "true"},
+		{"3 × 4 ÷ 2", "6"},
+		{"5 − 3", "2"},
+		{"−2²", "-4"},
+		{"√16", "4"},
+		{"2√(9 + 7)", "8"},
+		{"x = 3; x² + x³", "36"},
+		{"2^3²", "512"},
+		{"äö = 2; äö × 2", "4"},
+		{"x = 3\nx²\nx", "3"},
+		{"x = 3²\nx + 1", "10"},
+		{"x = 2\ny = x³\ny", "8"},
+	}
+
+	for _, test := range tests {
+		v, err := Eval(test.src)
+
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+		} else if v.String() != test.result {
+			t.Errorf("%s: result: %s, expected: %s", test.src, v, test.result)
+		}
+	}
+
+	s := scanner.NewFromString("π×x²\nx³\n")
+	expected := []struct {
+		kind   token.Kind
+		text   string
+		column int
+	}{
+		{token.IDENT, "π", 1},
+		{token.MUL, "×", 2},
+		{token.IDENT, "x", 3},
+		{token.SQUARE, "²", 4},
+		{token.NEWLINE, "\n", 5},
+		{token.IDENT, "x", 1},
+		{token.CUBE, "³", 2},
+		{token.NEWLINE, "\n", 3},
+		{token.EOF, "", 1},
+	}
+	for _, e := range expected {
+		tok, err := s.NextToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok.Kind() != e.kind || tok.String() != e.text || tok.Span().Start.Column != e.column {
+			t.Errorf("token: %s %q at %d, expected: %s %q at %d", tok.Kind(), tok, tok.Span().Start.Column, e.kind, e.text, e.column)
+		}
+	}
+
+	var errs diag.List
+	if _, err := Compile("1 + €"); !errors.As(err, &errs) || errs[0].Span.Start.Column != 5 {
+		t.Errorf("error: %v, expected unknown token at column 5", err)
+	}
+}
+
+func TestLiterals(t *testing.T) {
+	tests := []struct {
+		src    string
+		result string
+	}{
+		{"0o17", "15"},
+		{"0O17", "15"},
+		{"0b1010", "10"},
+		{"0xFF", "255"},
+		{"1_000_000", "1000000"},
+		{"0x_ff_ff", "65535"},
+		{"0b_1010_1010", "170"},
+		{"1_0.2_5", "10.25"},
+		{"1e1_0", "1e+10"},
+		{"0x1.8p3", "12"},
+		{"0x1p-2", "0.25"},
+		{"0x10p0", "16"},
+		{"0.", "0"},
+		{"1.", "1"},
+		{".5", "0.5"},
+		{"0", "0"},
+		{"0.5e1", "5"},
+		{"0x10pi == 16 * pi", "true"},
+		{"2exp(0)", "2"},
+		{"1_0i", "0+10i"},
+	}
+
+	for _, test := range tests {
+		v, err := MustCompile(test.src).Eval(nil, Complex())
+
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+		} else if v.String() != test.result {
+			t.Errorf("%s: result: %s, expected: %s", test.src, v, test.result)
+		}
+	}
+
+	malformed := []struct {
+		src string
+		err string
+	}{
+		{"0x", "1:1: malformed literal: 0x: hexadecimal literal has no digits"},
+		{"0b", "1:1: malformed literal: 0b: binary literal has no digits"},
+		{"0o", "1:1: malformed literal: 0o: octal literal has no digits"},
+		{"0b2", "1:1: malformed literal: 0b2: invalid digit '2' in binary literal"},
+		{"0o19", "1:1: malformed literal: 0o19: invalid digit '9' in octal literal"},
+		{"007", "1:1: malformed literal: 007: leading zero in decimal literal, use 0o for octal"},
+		{"1e", "1:1: malformed literal: 1e: exponent has no digits"},
+		{"1e+", "1:1: malformed literal: 1e+: exponent has no digits"},
+		{"2 * 1.5e-", "1:5: malformed literal: 1.5e-: exponent has no digits"},
+		{"0x1p", "1:1: malformed literal: 0x1p: exponent has no digits"},
+		{"0x1.8", "1:1: malformed literal: 0x1.8: hexadecimal mantissa requires a 'p' exponent"},
+		{"0b1.1", "1:1: malformed literal: 0b1.1: invalid radix point in binary literal"},
+		{"1__000", "1:1: malformed literal: 1__000: '_' must separate successive digits"},
+		{"1000_", "1:1: malformed literal: 1000_: '_' must separate successive digits"},
+		{"1_.5", "1:1: malformed literal: 1_.5: '_' must separate successive digits"},
+		{"0x_", "1:1: malformed literal: 0x_: hexadecimal literal has no digits"},
+	}
+
+	for _, test := range malformed {
+		_, err := Compile(test.src)
+
+		var errs diag.List
+		if !errors.As(err, &errs) || len(errs) != 1 {
+			t.Errorf("%s: expected error: %s, got: %v", test.src, test.err, err)
+		} else if errs[0].Error() != test.err {
+			t.Errorf("%s: error: %s, expected: %s", test.src, errs[0], test.err)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	tests := []struct {
+		src    string
+		result string
+	}{
+		{"2 /* comment */ * 3", "6"},
+		{"/* a /* nested */ comment */ 1", "1"},
+		{"2 /**/* 3", "6"},
+		{"x = 2 /* line\nbreak */ x + 1", "3"},
+		{"1 + /* line\nbreak */ 2", "3"},
+		{"4 // comment", "4"},
+	}
+
+	for _, test := range tests {
+		v, err := Eval(test.src)
+
+		if err != nil {
+			t.Errorf("%q: %v", test.src, err)
+		} else if v.String() != test.result {
+			t.Errorf("%q: result: %s, expected: %s", test.src, v, test.result)
+		}
+	}
+
+	if _, err := Eval("1 /* /* */"); err == nil || !strings.Contains(err.Error(), "1:3: unterminated comment") {
+		t.Errorf("error: %v, expected unterminated comment", err)
+	}
+
+	s := scanner.NewFromString("// header\n\nx = 1 // one\n/* two */\n\ny /* three */ /* four\n*/\n")
+	s.SetTrivia(true)
+	var tokens []*token.Token
+	for {
+		tok, err := s.NextToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, tok)
+		if tok.Kind() == token.EOF {
+			break
+		}
+	}
+
+	trivia := func(trivia []token.Trivia) string {
+		var texts []string
+		for _, tr := range trivia {
+			if tr.Kind == token.BlankLine {
+				texts = append(texts, fmt.Sprintf("blank@%d", tr.Span.Start.Line))
+			} else {
+				texts = append(texts, tr.Text)
+			}
+		}
+		return strings.Join(texts, ", ")
+	}
+
+	expected := []struct {
+		kind     token.Kind
+		leading  string
+		trailing string
+	}{
+		{token.IDENT, "// header, blank@2", ""},
+		{token.ASSIGN, "", ""},
+		{token.INT_LITERAL, "", "// one"},
+		{token.NEWLINE, "", ""},
+		{token.IDENT, "/* two */, blank@5", "/* three */, /* four\n*/"},
+		{token.NEWLINE, "", ""},
+		{token.EOF, "", ""},
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("tokens: %v, expected %d tokens", tokens, len(expected))
+	}
+	for i, e := range expected {
+		tok := tokens[i]
+		if tok.Kind() != e.kind || trivia(tok.Leading()) != e.leading || trivia(tok.Trailing()) != e.trailing {
+			t.Errorf("token %s: leading %q, trailing %q, expected: %s: leading %q, trailing %q",
+				tok.Kind(), trivia(tok.Leading()), trivia(tok.Trailing()), e.kind, e.leading, e.trailing)
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	s := scanner.NewStream(scanner.NewFromString("a + 0x * b"))
+
+	if tok, _ := s.Peek(3); tok.String() != "*" {
+		t.Errorf("peek: %v, expected: *", tok)
+	}
+	if tok, err := s.Peek(2); tok.Kind() != token.ILLEGAL || err == nil {
+		t.Errorf("peek: %v, error: %v, expected malformed literal", tok, err)
+	}
+
+	m := s.Mark()
+	s.Next()
+	s.Next()
+	if tok, _ := s.Peek(0); tok.String() != "0x" {
+		t.Errorf("current: %v, expected: 0x", tok)
+	}
+	s.Reset(m)
+	if tok, _ := s.Next(); tok.String() != "a" {
+		t.Errorf("next after reset: %v, expected: a", tok)
+	}
+
+	if tok, _ := s.Peek(100); tok.Kind() != token.EOF {
+		t.Errorf("peek beyond end: %v, expected EOF", tok)
+	}
+	for i := 0; i < 10; i++ {
+		s.Next()
+	}
+	if tok, _ := s.Next(); tok.Kind() != token.EOF {
+		t.Errorf("next beyond end: %v, expected EOF", tok)
+	}
+}
+
+func TestBuffer(t *testing.T) {
+	setup := func(s *scanner.Scanner) {
+		s.SetTrivia(true)
+		s.Define("<->")
+		s.DefinePostfix("!")
+	}
+
+	src := "// sum\nx = 1 + 2 // two\n\ny = x * 3\n/* done */\n"
+	edits := []scanner.Edit{
+		{Offset: 11, Removed: 1, Text: "10"},
+		{Offset: 0, Removed: 0, Text: "z = 2\n"},
+		{Offset: 13, Removed: 0, Text: "e"},
+		{Offset: 14, Removed: 0, Text: "x"},
+		{Offset: 15, Removed: 0, Text: "p(1)"},
+		{Offset: 26, Removed: 0, Text: "/* a\nb */ "},
+		{Offset: 6, Removed: 0, Text: "/* "},
+		{Offset: 6, Removed: 3, Text: ""},
+		{Offset: 26, Removed: 0, Text: "0b2 <-> "},
+		{Offset: 38, Removed: 0, Text: "\n\n"},
+		{Offset: 0, Removed: 7, Text: ""},
+		{Offset: 35, Removed: 0, Text: "π²"},
+		{Offset: 64, Removed: 0, Text: "!              + 1"},
+		{Offset: 78, Removed: 0, Text: "\n"},
+		{Offset: 65, Removed: 0, Text: " // bang"},
+		{Offset: 64, Removed: 1, Text: "*"},
+	}
+
+	b := scanner.NewBuffer(src, setup)
+	for _, e := range edits {
+		old := b.Tokens()
+		start, end, err := b.Update(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		full := scanner.NewBuffer(b.Source(), setup)
+
+		got, expected := b.Tokens(), full.Tokens()
+		if len(got) != len(expected) || start < 0 || start > end || end > len(got) || end+len(old)-len(got) < start {
+			t.Fatalf("%q: %d tokens, replaced [%d, %d), expected %d tokens", b.Source(), len(got), start, end, len(expected))
+		}
+		for i := 0; i < start; i++ {
+			if got[i] != old[i] {
+				t.Errorf("%q: token %d before the edit was replaced", b.Source(), i)
+			}
+		}
+		for i := end; i < len(got); i++ {
+			if o := old[i+len(old)-len(got)]; o.Kind() != got[i].Kind() || o.String() != got[i].String() {
+				t.Errorf("%q: token %d after the edit: %v, expected: %v", b.Source(), i, got[i], o)
+			}
+		}
+		for i := range got {
+			if !reflect.DeepEqual(got[i], expected[i]) {
+				t.Errorf("%q: token %d: %+v, expected: %+v", b.Source(), i, *got[i], *expected[i])
+			}
+		}
+		if !reflect.DeepEqual(b.Errors(), full.Errors()) {
+			t.Errorf("%q: errors: %v, expected: %v", b.Source(), b.Errors(), full.Errors())
+		}
+	}
+
+	long := strings.Repeat("x = 1 + 2 * 3\n", 1000)
+	b = scanner.NewBuffer(long, nil)
+	start, end, err := b.Update(scanner.Edit{Offset: 4, Removed: 1, Text: "42"})
+	if err != nil || end-start > 4 {
+		t.Errorf("replaced tokens [%d, %d), error: %v, expected few tokens", start, end, err)
+	}
+	if tokens := b.Tokens(); tokens[len(tokens)-1].Span().Start.Offset != len(long)+1 {
+		t.Errorf("end of input at %d, expected: %d", tokens[len(tokens)-1].Span().Start.Offset, len(long)+1)
+	}
+
+	if _, _, err := b.Update(scanner.Edit{Offset: len(b.Source()), Removed: 1}); err == nil {
+		t.Errorf("expected error for edit out of range")
+	}
+
+	stream := b.Stream()
+	for i, expected := range b.Tokens() {
+		if tok, _ := stream.Next(); tok.Kind() != expected.Kind() || tok.Span() != expected.Span() {
+			t.Fatalf("stream token %d: %s at %s, expected: %s at %s", i, tok.Kind(), tok.Span(), expected.Kind(), expected.Span())
+		}
+	}
+}
+
+func TestOperators(t *testing.T) {
+	reg := parser.NewRegistry()
+	reg.RegisterOperator(parser.Operator{
+		Symbol:     "!",
+		Precedence: parser.PrecPostfix,
+		Fixity:     parser.Postfix,
+		Unary: func(x ast.Node) ast.Node {
+			return ast.NewFactorialOp([]ast.Node{x})
+		},
+	})
+	reg.RegisterOperator(parser.Operator{
+		Symbol:     "<<",
+		Precedence: parser.PrecMultiplicative,
+		Binary: func(lhs, rhs ast.Node) ast.Node {
+			return ast.NewMulOp(lhs, ast.NewPowOp(ast.NewIntegerLiteral(2), rhs))
+		},
+	})
+	reg.RegisterOperator(parser.Operator{
+		Symbol:     "..",
+		Precedence: parser.PrecRelational - 5,
+		Binary: func(lhs, rhs ast.Node) ast.Node {
+			n := ast.NewPlusOp(ast.NewMinusOp(rhs, lhs), ast.NewIntegerLiteral(1))
+			return ast.NewDivOp(ast.NewMulOp(ast.NewPlusOp(lhs, rhs), n), ast.NewIntegerLiteral(2))
+		},
+	})
+	reg.RemoveOperator("#", parser.Infix)
+
+	tests := []struct {
+		input  string
+		result string
+		err    bool
+	}{
+		{"5!", "120", false},
+		{"3! + 2!!", "8", false},
+		{"-3!", "-6", false},
+		{"2^3!", "64", false},
+		{"!(1 < 2)", "false", false},
+		{"1 << 3 + 1", "9", false},
+		{"3 << 2 << 1", "24", false},
+		{"1 .. 2 + 2", "10", false},
+		{"1 .. 100 == 5050", "true", false},
+		{"1..5", "15", false},
+		{"0x1..0x3", "6", false},
+		{"1.5..3.5", "7.5", false},
+		{"x = 3!\nx + 1", "7", false},
+		{"3!\n!(1 < 2)", "false", false},
+		{"1 # 2", "", true},
+		{"1 <", "", true},
+	}
+
+	for _, test := range tests {
+		v, err := Eval(test.input, WithRegistry(reg))
+
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected error", test.input)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %v", test.input, err)
+		} else if v.String() != test.result {
+			t.Errorf("%s: result: %s, expected: %s", test.input, v, test.result)
+		}
+	}
+
+	if _, err := Eval("1 # 2"); err != nil {
+		t.Errorf("registry changes must not affect other parsers: %v", err)
+	}
+
+	v, err := Eval("2 ** 10", WithOperator(parser.Operator{
+		Symbol:     "**",
+		Precedence: parser.PrecPow,
+		Assoc:      parser.RightAssoc,
+		Binary:     ast.NewPowOp,
+	}))
+	if err != nil || v.String() != "1024" {
+		t.Errorf("2 ** 10: result: %s, error: %v", v, err)
+	}
+
+	s := scanner.NewFromString("1>>>>2**<<~")
+	for _, kind := range []token.Kind{token.INT_LITERAL, token.USHR, token.GTR, token.INT_LITERAL, token.POW, token.SHL, token.TILDE, token.EOF} {
+		tok, err := s.NextToken()
+		if err != nil || tok.Kind() != kind {
+			t.Errorf("token: %v, error: %v, expected: %s", tok, err, kind)
+		}
+	}
+}
+
 func TestDebug(t *testing.T) {
 	s := scanner.NewFromString("2+2")
 
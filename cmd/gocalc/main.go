@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/tympanix/gocalc/ast"
+	"github.com/tympanix/gocalc/diag"
+	"github.com/tympanix/gocalc/parser"
+	"github.com/tympanix/gocalc/scanner"
+	"github.com/tympanix/gocalc/scanner/token"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+var (
+	verbose  = flag.Bool("v", false, "verbose")
+	scanning = flag.Bool("s", false, "scanning")
+	parsing  = flag.Bool("p", false, "parsing")
+	input    = flag.String("i", "", "input")
+	last     = flag.Bool("l", false, "print only the result of the last statement")
+	degrees  = flag.Bool("deg", false, "use degrees for trigonometric functions")
+	ieee     = flag.Bool("ieee", false, "allow NaN and infinite results instead of errors")
+	bigints  = flag.Bool("big", false, "use arbitrary precision for integers which overflow 64 bits")
+	prec     = flag.Uint("prec", 0, "number of mantissa bits of arbitrary precision floats")
+	ratio    = flag.String("rat", "fraction", "format of rational numbers: fraction, mixed or decimal")
+	complexs = flag.Bool("complex", false, "compute complex results for real arguments outside the real domain")
+	polar    = flag.Bool("polar", false, "show complex numbers in polar form")
+	implicit = flag.String("implicit", "mul", "precedence of implicit multiplication: mul, high or off")
+	legacy   = flag.Bool("legacy", false, "parse exponentiation as left associative and binding weaker than unary minus")
+)
+
+// printTrivia prints comments and blank lines in the format of tokens
+func printTrivia(trivia []token.Trivia) {
+	for _, tr := range trivia {
+		fmt.Printf("%-8s %-12s: %q\n", tr.Span.Start, tr.Kind, tr.Text)
+	}
+}
+
+func main() {
+
+	var src []byte
+	var err error
+
+	flag.Parse()
+
+	if _, ok := ratFormats[*ratio]; !ok {
+		log.Fatalf("unknown format of rational numbers: %s", *ratio)
+	}
+
+	if _, ok := implicitPrecedences[*implicit]; !ok {
+		log.Fatalf("unknown precedence of implicit multiplication: %s", *implicit)
+	}
+
+	if len(*input) > 0 && flag.NArg() > 0 {
+		log.Fatal("too many arguments")
+	}
+
+	if len(*input) > 0 {
+		src, err = ioutil.ReadFile(*input)
+	}
+
+	if flag.NArg() > 0 {
+		src = []byte(flag.Arg(0))
+	}
+
+	if src == nil && err == nil {
+		stat, _ := os.Stdin.Stat()
+		if (stat.Mode() & os.ModeCharDevice) == 0 {
+			src, err = ioutil.ReadAll(os.Stdin)
+		}
+	}
+
+	if src == nil && err == nil {
+		term()
+		os.Exit(0)
+	}
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	s := scanner.NewFromString(string(src))
+
+	if *scanning {
+		s.SetTrivia(true)
+		var last *token.Token
+		for {
+			t, err := s.NextToken()
+			if err != nil {
+				log.Fatal(report(string(src), err))
+			}
+			// trailing trivia are attached once the next token is scanned
+			if last != nil {
+				printTrivia(last.Trailing())
+			}
+			printTrivia(t.Leading())
+			if t.Kind() == token.EOF {
+				return
+			}
+			fmt.Printf("%-8s %-12s: %s\n", t.Span().Start, t.Kind().String(), t.String())
+			last = t
+		}
+	}
+
+	ps := parser.New(s)
+	ps.SetLegacyPrecedence(*legacy)
+	ps.SetImplicitPrecedence(implicitPrecedences[*implicit])
+	n, err := ps.Parse()
+
+	if err != nil {
+		log.Fatal(report(string(src), err))
+	}
+
+	if err := n.Analyze(); err != nil {
+		log.Fatal(report(string(src), err))
+	}
+
+	if *parsing {
+		n.Print()
+		os.Exit(0)
+	}
+
+	env := newEnv()
+
+	for i, stmt := range n.Statements {
+		r, err := stmt.Calc(env)
+		if err != nil {
+			log.Fatal(report(string(src), err))
+		}
+		if *last && i == len(n.Statements)-1 || !*last && !ast.IsAssignment(stmt) {
+			fmt.Println(format(r))
+		}
+	}
+
+}
+
+func term() {
+	oldState, err := terminal.MakeRaw(0)
+	if err != nil {
+		panic(err)
+	}
+	defer terminal.Restore(0, oldState)
+
+	t := terminal.NewTerminal(os.Stdin, "> ")
+	scope := ast.NewScope()
+	env := newEnv()
+
+	t.AutoCompleteCallback = func(line string, pos int, key rune) (newline string, newPos int, ok bool) {
+		if key == '\x03' {
+			// Ctrl+C
+			os.Exit(0)
+		}
+		return "", 0, false
+	}
+
+	for {
+		text, err := t.ReadLine()
+		if err != nil {
+			if err == io.EOF {
+				return
+			}
+			panic(err)
+		}
+
+		text = strings.TrimSpace(text)
+
+		if len(text) == 0 {
+			continue
+		}
+
+		if text == "exit" || text == "quit" {
+			return
+		}
+
+		s := scanner.NewFromString(text)
+
+		// variables are only kept if the whole line is valid
+		next := scope.Clone()
+
+		ps := parser.NewWithScope(s, next)
+		ps.SetLegacyPrecedence(*legacy)
+		ps.SetImplicitPrecedence(implicitPrecedences[*implicit])
+		p, err := ps.Parse()
+
+		if err != nil {
+			t.Write([]byte(fmt.Sprintln(report(text, err))))
+			continue
+		}
+
+		if err := p.Analyze(); err != nil {
+			t.Write([]byte(fmt.Sprintln(report(text, err))))
+			continue
+		}
+
+		scope = next
+		for _, stmt := range p.Statements {
+			r, err := stmt.Calc(env)
+			if err != nil {
+				t.Write([]byte(fmt.Sprintln(report(text, err))))
+				env.Reset()
+				break
+			}
+			if !ast.IsAssignment(stmt) {
+				t.Write([]byte(fmt.Sprintln(format(r))))
+			}
+		}
+	}
+}
+
+var ratFormats = map[string]ast.RatFormat{
+	"fraction": ast.Fraction,
+	"mixed":    ast.Mixed,
+	"decimal":  ast.Decimal,
+}
+
+var implicitPrecedences = map[string]int{
+	"mul":  parser.PrecMultiplicative,
+	"high": parser.PrecImplicit,
+	"off":  0,
+}
+
+// format returns the textual representation of a result
+func format(v ast.Value) string {
+	f := ast.Format{Rat: ratFormats[*ratio]}
+	if *polar {
+		f.Complex = ast.Polar
+	}
+	return ast.FormatValue(v, f)
+}
+
+func newEnv() *ast.Env {
+	env := ast.NewEnv(context.Background())
+	if *degrees {
+		env.Angle = ast.Degrees
+	}
+	env.IEEE = *ieee
+	env.Complex = *complexs
+	if *bigints {
+		env.Integers = ast.BigIntegers
+	}
+	env.Precision = *prec
+	return env
+}
+
+// report formats the error together with an excerpt of the source line
+// pointing out the error location, if the error is located in the source
+func report(src string, err error) string {
+	var list diag.List
+	if errors.As(err, &list) {
+		msgs := make([]string, len(list))
+		for i, d := range list {
+			msgs[i] = excerpt(src, d.Span, d)
+			if d.Severity != diag.Error {
+				msgs[i] = fmt.Sprintf("%s: %s", d.Severity, msgs[i])
+			}
+		}
+		return strings.Join(msgs, "\n")
+	}
+	if span, ok := errorSpan(err); ok {
+		return excerpt(src, span, err)
+	}
+	return err.Error()
+}
+
+func excerpt(src string, span token.Span, err error) string {
+	if excerpt := span.Excerpt(src); len(excerpt) > 0 {
+		return fmt.Sprintf("%s\n%s", err, excerpt)
+	}
+	return err.Error()
+}
+
+// errorSpan returns the location of errors from scanning, parsing, analysis
+// and evaluation
+func errorSpan(err error) (token.Span, bool) {
+	var (
+		scanErr    *scanner.Error
+		syntaxErr  *parser.SyntaxError
+		typeErr    *ast.TypeError
+		runtimeErr *ast.RuntimeError
+	)
+	switch {
+	case errors.As(err, &scanErr):
+		return scanErr.Span, true
+	case errors.As(err, &syntaxErr):
+		return syntaxErr.Span, true
+	case errors.As(err, &typeErr):
+		return typeErr.Span, true
+	case errors.As(err, &runtimeErr):
+		return runtimeErr.Span, true
+	}
+	return token.Span{}, false
+}
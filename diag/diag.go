@@ -0,0 +1,127 @@
+package diag
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tympanix/gocalc/scanner/token"
+)
+
+// Severity denotes how severe a diagnostic is
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+)
+
+// String returns the name of the severity
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	default:
+		return "error"
+	}
+}
+
+// Diagnostic is a problem located in the source
+type Diagnostic struct {
+	Severity Severity
+	Span     token.Span
+	Err      error
+}
+
+// Error returns the message of the underlying error
+func (d *Diagnostic) Error() string {
+	return d.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (d *Diagnostic) Unwrap() error {
+	return d.Err
+}
+
+// List is a list of diagnostics. A non-empty list is itself an error.
+type List []*Diagnostic
+
+// Add adds an error located at span to the list
+func (l *List) Add(span token.Span, err error) {
+	*l = append(*l, &Diagnostic{Severity: Error, Span: span, Err: err})
+}
+
+// Warn adds a warning located at span to the list
+func (l *List) Warn(span token.Span, err error) {
+	*l = append(*l, &Diagnostic{Severity: Warning, Span: span, Err: err})
+}
+
+// Append adds all diagnostics of err to the list, if err is a list. Any other
+// non-nil error is added as an error without location.
+func (l *List) Append(err error) {
+	switch e := err.(type) {
+	case nil:
+	case List:
+		*l = append(*l, e...)
+	case *Diagnostic:
+		*l = append(*l, e)
+	default:
+		l.Add(token.Span{}, err)
+	}
+}
+
+// Sort sorts the list by position in the source
+func (l List) Sort() {
+	sort.SliceStable(l, func(i, j int) bool {
+		return l[i].Span.Start.Offset < l[j].Span.Start.Offset
+	})
+}
+
+// HasErrors reports whether the list contains diagnostics of error severity
+func (l List) HasErrors() bool {
+	for _, d := range l {
+		if d.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns the list as an error if it contains any errors, or nil otherwise
+func (l List) Err() error {
+	if l.HasErrors() {
+		return l
+	}
+	return nil
+}
+
+// Error returns the message of the first diagnostic and the number of
+// remaining diagnostics
+func (l List) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more)", l[0].Error(), len(l)-1)
+}
+
+// Unwrap returns the diagnostics of the list, such that errors.As and
+// errors.Is inspect every diagnostic
+func (l List) Unwrap() []error {
+	errs := make([]error, len(l))
+	for i, d := range l {
+		errs[i] = d
+	}
+	return errs
+}
+
+// String returns every diagnostic on a separate line
+func (l List) String() string {
+	lines := make([]string, len(l))
+	for i, d := range l {
+		lines[i] = d.Error()
+	}
+	return strings.Join(lines, "\n")
+}
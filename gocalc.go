@@ -0,0 +1,420 @@
+// Package gocalc evaluates mathematical expressions. It wires together the
+// scanner, parser and analyzer, such that formulas can be embedded in other
+// Go programs:
+//
+//	e, err := gocalc.Compile("sqrt(x^2 + y^2)", gocalc.WithVars("x", "y"))
+//	if err != nil {
+//		// handle syntax and type errors
+//	}
+//	v, err := e.Eval(gocalc.Env{"x": 3, "y": 4})
+package gocalc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/tympanix/gocalc/ast"
+	"github.com/tympanix/gocalc/parser"
+	"github.com/tympanix/gocalc/scanner"
+)
+
+// ErrNoResult is returned by Eval if the program has no result, which is the
+// case if it is empty or ends with a function definition
+var ErrNoResult = errors.New("no result")
+
+// Env holds the values of the variables declared with WithVars
+type Env map[string]float64
+
+// Value is the result of evaluating an expression
+type Value struct {
+	v ast.Value
+}
+
+// Type returns the type of the value
+func (v Value) Type() ast.Type {
+	if v.v == nil {
+		return ast.UNKNOWN
+	}
+	return v.v.Type()
+}
+
+// Float64 returns the value as a float
+func (v Value) Float64() float64 {
+	return ast.ToFloat(v.v)
+}
+
+// Int64 returns the value as an int64. It reports false if the value is
+// not an integer in the range of int64.
+func (v Value) Int64() (int64, bool) {
+	i, ok := v.v.(ast.Int)
+	return int64(i), ok
+}
+
+// Uint64 returns the value as an uint64. It reports false if the value is
+// not an integer in the range of uint64.
+func (v Value) Uint64() (uint64, bool) {
+	switch i := v.v.(type) {
+	case ast.Int:
+		return uint64(i), i >= 0
+	case ast.Uint:
+		return uint64(i), true
+	}
+	return 0, false
+}
+
+// BigInt returns a copy of the value as an arbitrary precision integer. It
+// reports false if the value is not an integer.
+func (v Value) BigInt() (*big.Int, bool) {
+	switch i := v.v.(type) {
+	case ast.Int:
+		return big.NewInt(int64(i)), true
+	case ast.Uint:
+		return new(big.Int).SetUint64(uint64(i)), true
+	case ast.BigInt:
+		return new(big.Int).Set(i.Int), true
+	}
+	return nil, false
+}
+
+// Rat returns a copy of the value as a rational number. It reports false if
+// the value is not an integer or a rational number.
+func (v Value) Rat() (*big.Rat, bool) {
+	if r, ok := v.v.(ast.Rat); ok {
+		return new(big.Rat).Set(r.Rat), true
+	}
+	if i, ok := v.BigInt(); ok {
+		return new(big.Rat).SetInt(i), true
+	}
+	return nil, false
+}
+
+// BigFloat returns a copy of the value as an arbitrary precision float. It
+// reports false if the value is not a finite number.
+func (v Value) BigFloat() (*big.Float, bool) {
+	if f, ok := v.v.(ast.BigFloat); ok {
+		return new(big.Float).Copy(f.Float), true
+	}
+	f := v.Float64()
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, false
+	}
+	if i, ok := v.BigInt(); ok {
+		return new(big.Float).SetInt(i), true
+	}
+	return big.NewFloat(f), true
+}
+
+// Bool returns the value as a boolean. It reports false if the value is not
+// a boolean.
+func (v Value) Bool() (bool, bool) {
+	b, ok := v.v.(ast.Bool)
+	return bool(b), ok
+}
+
+// Complex128 returns the value as a complex number. It reports false if the
+// value is not a number.
+func (v Value) Complex128() (complex128, bool) {
+	if c, ok := v.v.(ast.Complex); ok {
+		return complex128(c), true
+	}
+	f := v.Float64()
+	return complex(f, 0), !math.IsNaN(f)
+}
+
+// Text returns the textual representation of the value, showing rational
+// and complex numbers in the given format
+func (v Value) Text(f ast.Format) string {
+	if v.v == nil {
+		return v.String()
+	}
+	return ast.FormatValue(v.v, f)
+}
+
+// String returns the textual representation of the value
+func (v Value) String() string {
+	if v.v == nil {
+		return ast.Float(v.Float64()).String()
+	}
+	return v.v.String()
+}
+
+type config struct {
+	vars   []string
+	reg    *parser.Registry
+	regs   []func(*parser.Registry)
+	legacy bool
+	// implicit is the precedence of implicit multiplication, if set
+	implicit *int
+}
+
+// Option configures the compilation of an expression
+type Option func(*config)
+
+// WithVars declares variables whose values are given when the expression is
+// evaluated. The variables are of type FLOAT.
+func WithVars(names ...string) Option {
+	return func(c *config) {
+		c.vars = append(c.vars, names...)
+	}
+}
+
+// WithRegistry compiles the expression using a copy of the given registry
+// instead of the builtin functions and constants. Functions and constants
+// registered by other options are added to the copy.
+func WithRegistry(r *parser.Registry) Option {
+	return func(c *config) {
+		c.reg = r
+	}
+}
+
+// WithConst registers a constant, shadowing any builtin constant of the
+// same name
+func WithConst(name string, value float64) Option {
+	return func(c *config) {
+		c.regs = append(c.regs, func(r *parser.Registry) {
+			r.RegisterConst(name, ast.FLOAT, value)
+		})
+	}
+}
+
+// WithFunc registers a function taking nparams parameters, shadowing any
+// builtin function of the same name
+func WithFunc(name string, nparams int, fn func(args []float64) float64) Option {
+	sig := ast.Signature{Params: make([]ast.Type, nparams), Result: ast.FLOAT}
+	for i := range sig.Params {
+		sig.Params[i] = ast.FLOAT
+	}
+	return func(c *config) {
+		c.regs = append(c.regs, func(r *parser.Registry) {
+			r.RegisterFunc(name, sig, fn)
+		})
+	}
+}
+
+// Without removes the named builtin functions and constants
+func Without(names ...string) Option {
+	return func(c *config) {
+		c.regs = append(c.regs, func(r *parser.Registry) {
+			for _, name := range names {
+				r.RemoveFunc(name)
+				r.RemoveConst(name)
+			}
+		})
+	}
+}
+
+// WithOperator registers a custom operator, shadowing any operator of the
+// same symbol and fixity
+func WithOperator(op parser.Operator) Option {
+	return func(c *config) {
+		c.regs = append(c.regs, func(r *parser.Registry) {
+			r.RegisterOperator(op)
+		})
+	}
+}
+
+// WithImplicitPrecedence sets the precedence of implicit multiplication such
+// as 2pi or 3(x+1), which defaults to the precedence of *. With
+// parser.PrecImplicit, 1/2x is 1/(2x). Zero disables implicit
+// multiplication.
+func WithImplicitPrecedence(prec int) Option {
+	return func(c *config) {
+		c.implicit = &prec
+	}
+}
+
+// WithLegacyPrecedence parses exponentiation as left associative and binding
+// weaker than unary minus, as in earlier versions, such that 2^3^2 is 64 and
+// -2^2 is 4
+func WithLegacyPrecedence() Option {
+	return func(c *config) {
+		c.legacy = true
+	}
+}
+
+// Expr is a compiled expression which can be evaluated any number of times
+type Expr struct {
+	src  string
+	prog *ast.Program
+	vars map[string]*ast.Variable
+}
+
+// Compile parses and analyzes the source. Syntax and type errors are
+// returned as a diag.List.
+func Compile(src string, opts ...Option) (*Expr, error) {
+	var c config
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	reg := parser.NewRegistry()
+	if c.reg != nil {
+		reg = c.reg.Clone()
+	}
+	for _, fn := range c.regs {
+		fn(reg)
+	}
+
+	scope := ast.NewScope()
+	vars := make(map[string]*ast.Variable)
+	for _, name := range c.vars {
+		vars[name] = scope.Declare(name, ast.FLOAT)
+	}
+
+	p := parser.NewWithScope(scanner.NewFromString(src), scope)
+	p.SetRegistry(reg)
+	p.SetLegacyPrecedence(c.legacy)
+	if c.implicit != nil {
+		p.SetImplicitPrecedence(*c.implicit)
+	}
+
+	prog, err := p.Parse()
+	if err != nil {
+		return nil, err
+	}
+	if err := prog.Analyze(); err != nil {
+		return nil, err
+	}
+	return &Expr{src: src, prog: prog, vars: vars}, nil
+}
+
+// MustCompile is like Compile but panics if the source can not be compiled
+func MustCompile(src string, opts ...Option) *Expr {
+	e, err := Compile(src, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// EvalOption configures the environment of an evaluation
+type EvalOption func(*evalConfig)
+
+type evalConfig struct {
+	ctx          context.Context
+	angle        ast.AngleMode
+	maxCallDepth int
+	maxCalls     int
+	ieee         bool
+	integers     ast.IntegerMode
+	complex      bool
+	prec         uint
+}
+
+// Context stops the evaluation with an error once ctx is done
+func Context(ctx context.Context) EvalOption {
+	return func(c *evalConfig) {
+		c.ctx = ctx
+	}
+}
+
+// Angle sets the unit of angles for trigonometric functions
+func Angle(mode ast.AngleMode) EvalOption {
+	return func(c *evalConfig) {
+		c.angle = mode
+	}
+}
+
+// MaxCallDepth limits the depth of nested calls to user functions
+func MaxCallDepth(n int) EvalOption {
+	return func(c *evalConfig) {
+		c.maxCallDepth = n
+	}
+}
+
+// MaxCalls limits the total number of calls to user functions
+func MaxCalls(n int) EvalOption {
+	return func(c *evalConfig) {
+		c.maxCalls = n
+	}
+}
+
+// IEEE disables errors for division by zero, domain errors and overflow,
+// such that the result may be NaN or infinite instead
+func IEEE() EvalOption {
+	return func(c *evalConfig) {
+		c.ieee = true
+	}
+}
+
+// BigIntegers computes integers with arbitrary precision once they no longer
+// fit in 64 bits, instead of reporting overflow
+func BigIntegers() EvalOption {
+	return func(c *evalConfig) {
+		c.integers = ast.BigIntegers
+	}
+}
+
+// Complex computes complex results for real arguments outside the domain of
+// real functions, such as the square root of a negative number, instead of
+// reporting a domain error
+func Complex() EvalOption {
+	return func(c *evalConfig) {
+		c.complex = true
+	}
+}
+
+// Precision computes floats with the given number of mantissa bits instead
+// of in 64-bit IEEE arithmetic. Zero restores 64-bit arithmetic.
+func Precision(bits uint) EvalOption {
+	return func(c *evalConfig) {
+		c.prec = bits
+	}
+}
+
+// Eval evaluates the expression with the variables bound to the values in
+// env, and returns the result of the last statement. An Expr may be
+// evaluated concurrently. Errors during evaluation are returned as an
+// *ast.RuntimeError, while ErrNoResult is returned if the last statement has
+// no result.
+func (e *Expr) Eval(env Env, opts ...EvalOption) (Value, error) {
+	c := evalConfig{
+		ctx:          context.Background(),
+		maxCallDepth: ast.DefaultMaxCallDepth,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	ev := ast.NewEnv(c.ctx)
+	ev.Angle = c.angle
+	ev.MaxCallDepth = c.maxCallDepth
+	ev.MaxCalls = c.maxCalls
+	ev.IEEE = c.ieee
+	ev.Integers = c.integers
+	ev.Complex = c.complex
+	ev.Precision = c.prec
+
+	for name, v := range e.vars {
+		value, ok := env[name]
+		if !ok {
+			return Value{}, fmt.Errorf("unbound variable: %s", name)
+		}
+		ev.Set(v, ast.Float(value))
+	}
+	r, err := e.prog.Calc(ev)
+	if err != nil {
+		return Value{}, err
+	}
+	if r == nil {
+		return Value{}, ErrNoResult
+	}
+	return Value{v: r}, nil
+}
+
+// String returns the source of the expression
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Eval compiles and evaluates the source
+func Eval(src string, opts ...Option) (Value, error) {
+	e, err := Compile(src, opts...)
+	if err != nil {
+		return Value{}, err
+	}
+	return e.Eval(nil)
+}
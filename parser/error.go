@@ -0,0 +1,65 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tympanix/gocalc/scanner/token"
+)
+
+// ErrorKind classifies syntax errors
+type ErrorKind int
+
+const (
+	// UnexpectedToken is reported when the parser finds a token which is not
+	// allowed at the current position
+	UnexpectedToken ErrorKind = iota
+	// InvalidLiteral is reported when a numeric literal can not be converted
+	InvalidLiteral
+	// UndefinedIdentifier is reported when an identifier does not name a
+	// variable or constant
+	UndefinedIdentifier
+	// UndefinedFunction is reported when an identifier does not name a function
+	UndefinedFunction
+	// DuplicateParameter is reported when a function definition declares
+	// the same parameter twice
+	DuplicateParameter
+)
+
+// SyntaxError is an error encountered while parsing the input
+type SyntaxError struct {
+	Kind     ErrorKind
+	Span     token.Span
+	Expected []token.Kind // tokens allowed at the position, if known
+	Found    *token.Token // the offending token
+	Err      error        // underlying error, for InvalidLiteral
+}
+
+// Error returns the error message prefixed with the position
+func (e *SyntaxError) Error() string {
+	switch e.Kind {
+	case InvalidLiteral:
+		return fmt.Sprintf("%s: invalid literal: %s", e.Span, e.Err)
+	case UndefinedIdentifier:
+		return fmt.Sprintf("%s: undefined identifier: %s", e.Span, e.Found)
+	case UndefinedFunction:
+		return fmt.Sprintf("%s: undefined function: %s", e.Span, e.Found)
+	case DuplicateParameter:
+		return fmt.Sprintf("%s: duplicate parameter: %s", e.Span, e.Found)
+	}
+	if len(e.Expected) == 1 {
+		return fmt.Sprintf("%s: expected token: %s, found: %s", e.Span, e.Expected[0], e.Found.Kind())
+	} else if len(e.Expected) > 1 {
+		kinds := make([]string, len(e.Expected))
+		for i, k := range e.Expected {
+			kinds[i] = k.String()
+		}
+		return fmt.Sprintf("%s: expected one of: %s, found: %s", e.Span, strings.Join(kinds, ", "), e.Found.Kind())
+	}
+	return fmt.Sprintf("%s: unexpected token: %s", e.Span, e.Found.Kind())
+}
+
+// Unwrap returns the underlying error, if any
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,122 @@
+package parser
+
+import "github.com/tympanix/gocalc/ast"
+
+// Associativity denotes how operators of the same precedence are grouped
+type Associativity int
+
+const (
+	// LeftAssoc groups operators from the left, e.g. 1-2-3 is (1-2)-3
+	LeftAssoc Associativity = iota
+	// RightAssoc groups operators from the right, e.g. 2^3^2 is 2^(3^2)
+	RightAssoc
+)
+
+// Fixity denotes the position of an operator relative to its operands
+type Fixity int
+
+const (
+	// Infix operators are placed between their two operands
+	Infix Fixity = iota
+	// Prefix operators are placed before their operand
+	Prefix
+	// Postfix operators are placed after their operand
+	Postfix
+)
+
+// Precedence levels of the builtin operators. Operators of higher precedence
+// bind tighter. The levels are spaced apart, such that custom operators may
+// be placed in between. PrecImplicit is the precedence of implicit
+// multiplication in the style of many calculators, such that 1/2x is 1/(2x).
+const (
+	PrecLogicalOr      = 10
+	PrecLogicalAnd     = 20
+	PrecEquality       = 30
+	PrecRelational     = 40
+	PrecBitwiseOr      = 50
+	PrecBitwiseXor     = 60
+	PrecBitwiseAnd     = 70
+	PrecShift          = 75
+	PrecAdditive       = 80
+	PrecMultiplicative = 90
+	PrecImplicit       = 95
+	PrecPrefix         = 100
+	PrecPow            = 110
+	PrecPostfix        = 120
+)
+
+// Operator declares an operator of the expression grammar. The precedence
+// must be positive. The operand of a prefix operator extends over operators
+// of at least the same precedence, such that -2^2 is -(2^2). Infix operators
+// are constructed by Binary, while prefix and postfix operators are
+// constructed by Unary.
+type Operator struct {
+	Symbol     string
+	Precedence int
+	Assoc      Associativity
+	Fixity     Fixity
+	Binary     func(lhs, rhs ast.Node) ast.Node
+	Unary      func(x ast.Node) ast.Node
+}
+
+// opKey identifies an operator, since a symbol may denote both an infix and
+// a prefix or postfix operator, e.g. -
+type opKey struct {
+	symbol string
+	fixity Fixity
+}
+
+// builtin operators, which are cloned into every new registry
+var operators = []Operator{
+	{Symbol: "||", Precedence: PrecLogicalOr, Binary: ast.NewLogicalOrOp},
+	{Symbol: "&&", Precedence: PrecLogicalAnd, Binary: ast.NewLogicalAndOp},
+	{Symbol: "==", Precedence: PrecEquality, Binary: ast.NewEqualOp},
+	{Symbol: "!=", Precedence: PrecEquality, Binary: ast.NewNotEqualOp},
+	{Symbol: "<", Precedence: PrecRelational, Binary: ast.NewLessOp},
+	{Symbol: "<=", Precedence: PrecRelational, Binary: ast.NewLessEqualOp},
+	{Symbol: ">", Precedence: PrecRelational, Binary: ast.NewGreaterOp},
+	{Symbol: ">=", Precedence: PrecRelational, Binary: ast.NewGreaterEqualOp},
+	{Symbol: "|", Precedence: PrecBitwiseOr, Binary: ast.NewBitwiseOrOp},
+	{Symbol: "#", Precedence: PrecBitwiseXor, Binary: ast.NewBitwiseXorOp},
+	{Symbol: "&", Precedence: PrecBitwiseAnd, Binary: ast.NewBitwiseAndOp},
+	{Symbol: "<<", Precedence: PrecShift, Binary: ast.NewShiftLeftOp},
+	{Symbol: ">>", Precedence: PrecShift, Binary: ast.NewShiftRightOp},
+	{Symbol: ">>>", Precedence: PrecShift, Binary: ast.NewUnsignedShiftRightOp},
+	{Symbol: "+", Precedence: PrecAdditive, Binary: ast.NewPlusOp},
+	{Symbol: "-", Precedence: PrecAdditive, Binary: ast.NewMinusOp},
+	{Symbol: "*", Precedence: PrecMultiplicative, Binary: ast.NewMulOp},
+	{Symbol: "/", Precedence: PrecMultiplicative, Binary: ast.NewDivOp},
+	{Symbol: "%", Precedence: PrecMultiplicative, Binary: ast.NewModOp},
+	{Symbol: "-", Precedence: PrecPrefix, Fixity: Prefix, Unary: ast.NewNegOp},
+	{Symbol: "!", Precedence: PrecPrefix, Fixity: Prefix, Unary: ast.NewNotOp},
+	{Symbol: "~", Precedence: PrecPrefix, Fixity: Prefix, Unary: ast.NewBitwiseNotOp},
+	{Symbol: "√", Precedence: PrecPrefix, Fixity: Prefix, Unary: sqrt},
+	{Symbol: "^", Precedence: PrecPow, Assoc: RightAssoc, Binary: ast.NewPowOp},
+	{Symbol: "²", Precedence: PrecPow, Fixity: Postfix, Unary: power(2)},
+	{Symbol: "³", Precedence: PrecPow, Fixity: Postfix, Unary: power(3)},
+}
+
+// sqrt returns the AST node for the square root of x
+func sqrt(x ast.Node) ast.Node {
+	return ast.NewSqrtOp([]ast.Node{x})
+}
+
+// power returns a constructor of AST nodes raising x to the power of n
+func power(n uint64) func(x ast.Node) ast.Node {
+	return func(x ast.Node) ast.Node {
+		return ast.NewPowOp(x, ast.NewIntegerLiteral(n))
+	}
+}
+
+// legacyOperator adjusts a builtin operator to the precedence rules of
+// earlier versions, in which exponentiation is left associative and binds
+// weaker than the prefix operators
+func legacyOperator(op Operator) Operator {
+	switch {
+	case op.Fixity == Infix && op.Precedence == PrecPow:
+		op.Assoc = LeftAssoc
+	case op.Fixity == Prefix && op.Precedence == PrecPrefix:
+		op.Precedence = PrecPow + 1
+	}
+	return op
+}
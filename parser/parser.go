@@ -2,81 +2,153 @@ package parser
 
 import (
 	"errors"
-	"fmt"
+	"math/big"
 	"strconv"
+	"strings"
 
 	"github.com/tympanix/gocalc/ast"
+	"github.com/tympanix/gocalc/diag"
 	"github.com/tympanix/gocalc/scanner"
 	"github.com/tympanix/gocalc/scanner/token"
 )
 
-type funcExpFactory func(params []ast.Node) ast.Node
-type constFactory func() ast.Node
-
-var (
-	functions = map[string]funcExpFactory{
-		"sqrt":  ast.NewSqrtOp,
-		"log":   ast.NewLog10Op,
-		"log10": ast.NewLog10Op,
-		"log2":  ast.NewLog2Op,
-		"pow":   ast.NewPowFnOp,
-		"sin":   ast.NewSinOp,
-		"cos":   ast.NewCosOp,
-		"tan":   ast.NewTanOp,
-		"asin":  ast.NewAsinOp,
-		"acos":  ast.NewAcosOp,
-		"atan":  ast.NewAtanOp,
-		"ln":    ast.NewLnOp,
-		"abs":   ast.NewAbsOp,
-		"rad":   ast.NewRadOp,
-		"deg":   ast.NewDegOp,
-		"round": ast.NewRoundOp,
-		"floor": ast.NewFloorOp,
-		"ceil":  ast.NewCeilOp,
-	}
-
-	constants = map[string]constFactory{
-		"pi": ast.NewPiOp,
-		"π":  ast.NewPiOp,
-		"e":  ast.NewEulerOp,
-	}
-)
-
 // Parser parses the input program from a scanner
 type Parser struct {
 	s      *scanner.Scanner
-	tokens []*token.Token
+	ts     *scanner.Stream
 	prev   *token.Token
-	i      int
+	errs   diag.List
+	scope  *ast.Scope
+	reg    *Registry
+	depth  int
+	legacy bool
+	// implicit is the precedence of implicit multiplication, or zero if
+	// it is disabled
+	implicit int
 }
 
 // New return a new parser
 func New(s *scanner.Scanner) *Parser {
-	return &Parser{s: s}
+	return NewWithScope(s, ast.NewScope())
+}
+
+// NewWithScope returns a new parser which resolves and defines variables in
+// the given scope
+func NewWithScope(s *scanner.Scanner, scope *ast.Scope) *Parser {
+	return &Parser{
+		s:        s,
+		ts:       scanner.NewStream(s),
+		scope:    scope,
+		reg:      NewRegistry(),
+		implicit: PrecMultiplicative,
+	}
+}
+
+// Registry returns the registry of functions and constants used by the
+// parser. Changes to the registry apply to the parser only.
+func (p *Parser) Registry() *Registry {
+	return p.reg
+}
+
+// SetRegistry sets the registry of functions and constants used by the parser
+func (p *Parser) SetRegistry(r *Registry) {
+	p.reg = r
 }
 
-func (p *Parser) pump(n int) {
-	for len(p.tokens) < n {
-		next := p.s.NextToken()
-		p.tokens = append(p.tokens, next)
+// SetLegacyPrecedence enables the precedence rules of earlier versions, in
+// which exponentiation is left associative and binds weaker than unary minus,
+// such that 2^3^2 is 64 and -2^2 is 4
+func (p *Parser) SetLegacyPrecedence(legacy bool) {
+	p.legacy = legacy
+}
+
+// SetImplicitPrecedence sets the precedence of implicit multiplication, i.e.
+// juxtaposition such as 2pi, 3(x+1) or (a+b)(a-b). It defaults to the
+// precedence of *, while PrecImplicit binds tighter than division, such that
+// 1/2x is 1/(2x). Zero disables implicit multiplication.
+func (p *Parser) SetImplicitPrecedence(prec int) {
+	p.implicit = prec
+}
+
+// report records err as a diagnostic, unless an error has already been
+// reported at the same position
+func (p *Parser) report(err error) {
+	var span token.Span
+	switch e := err.(type) {
+	case *SyntaxError:
+		span = e.Span
+	case *scanner.Error:
+		span = e.Span
+	}
+	for _, d := range p.errs {
+		if d.Span.Start == span.Start {
+			return
+		}
 	}
+	p.errs.Add(span, err)
 }
 
+// sync skips tokens until one of the stop tokens is found outside of any
+// parentheses, or the end of input is reached
+func (p *Parser) sync(stop ...token.Kind) {
+	depth := 0
+	for !p.see(token.EOF) {
+		if depth == 0 {
+			for _, k := range stop {
+				if p.see(k) {
+					return
+				}
+			}
+		}
+		if p.see(token.LPAR) {
+			depth++
+		} else if p.see(token.RPAR) && depth > 0 {
+			depth--
+		}
+		p.pop()
+	}
+}
+
+// current returns the current token. Scanner errors are reported, while the
+// erroneous input is represented by an ILLEGAL token, such that parsing may
+// continue. Line breaks inside parentheses are skipped.
 func (p *Parser) current() *token.Token {
-	p.pump(1)
-	return p.tokens[0]
+	for {
+		t, err := p.ts.Peek(0)
+		if err != nil {
+			p.report(err)
+		}
+		if t.Kind() != token.NEWLINE || p.depth == 0 {
+			return t
+		}
+		p.ts.Next()
+	}
+}
+
+// peek returns the token n positions after the current token
+func (p *Parser) peek(n int) *token.Token {
+	p.current()
+	t, _ := p.ts.Peek(n)
+	return t
 }
 
+// pop consumes the current token and keeps track of the depth of the
+// parentheses
 func (p *Parser) pop() {
-	if len(p.tokens) > 0 {
-		p.prev = p.tokens[0]
-		p.tokens = p.tokens[1:]
+	t := p.current()
+	switch t.Kind() {
+	case token.LPAR:
+		p.depth++
+	case token.RPAR:
+		if p.depth > 0 {
+			p.depth--
+		}
 	}
-	p.pump(1)
+	p.prev = t
+	p.ts.Next()
 }
 
 func (p *Parser) have(t token.Kind) bool {
-	p.pump(1)
 	e := p.current()
 
 	if e.Kind() == t {
@@ -90,188 +162,471 @@ func (p *Parser) see(t token.Kind) bool {
 	return p.current().Kind() == t
 }
 
-func (p *Parser) expect(t token.Kind) *token.Token {
+func (p *Parser) expect(t token.Kind) (*token.Token, error) {
 	if !p.have(t) {
-		panic(fmt.Sprintf("expected token: %s\n", t.String()))
+		return nil, p.unexpected(t)
 	}
-	return p.last()
+	return p.last(), nil
 }
 
-func (p *Parser) last() *token.Token {
-	return p.prev
+// unexpected returns a syntax error for the current token
+func (p *Parser) unexpected(expected ...token.Kind) error {
+	return &SyntaxError{
+		Kind:     UnexpectedToken,
+		Span:     p.current().Span(),
+		Expected: expected,
+		Found:    p.current(),
+	}
 }
 
-// Parse parses the program
-func (p *Parser) Parse() (exp ast.Node, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = errors.New(fmt.Sprint(r))
-		}
-	}()
-	exp = p.parseExpression()
-	p.expect(token.EOF)
-	return exp, nil
+func (p *Parser) last() *token.Token {
+	return p.prev
 }
 
-func (p *Parser) parseExpression() ast.Node {
-	return p.parseBitwiseOr()
+// node sets the span of n to cover from start to the last token consumed
+func (p *Parser) node(n ast.Node, start token.Span) ast.Node {
+	n.SetSpan(start.Join(p.last().Span()))
+	return n
 }
 
-func (p *Parser) parseBitwiseOr() ast.Node {
-	lhs := p.parseBitwiseXor()
-
-	for {
-		if p.have(token.OR) {
-			lhs = ast.NewBitwiseOrOp(lhs, p.parseBitwiseXor())
+// Parse parses the program. The parser recovers from syntax errors at
+// statement boundaries, such that all errors are returned as a diag.List.
+func (p *Parser) Parse() (*ast.Program, error) {
+	for _, op := range p.reg.Operators() {
+		if op.Fixity == Postfix {
+			p.s.DefinePostfix(op.Symbol)
 		} else {
+			p.s.Define(op.Symbol)
+		}
+	}
+	prog := ast.NewProgram()
+	for {
+		for p.have(token.NEWLINE) || p.have(token.SEMICOLON) {
+			// skip empty statements
+		}
+		if p.see(token.EOF) {
 			break
 		}
+		stmt, err := p.parseStatement()
+		if err != nil {
+			p.report(err)
+			p.sync(token.NEWLINE, token.SEMICOLON)
+		} else {
+			prog.Add(stmt)
+		}
+		if !p.see(token.EOF) && !p.have(token.NEWLINE) && !p.have(token.SEMICOLON) {
+			p.report(p.unexpected(token.SEMICOLON, token.NEWLINE, token.EOF))
+			p.sync(token.NEWLINE, token.SEMICOLON)
+		}
 	}
-	return lhs
+	p.errs.Sort()
+	if err := p.errs.Err(); err != nil {
+		return nil, err
+	}
+	return prog, nil
 }
 
-func (p *Parser) parseBitwiseXor() ast.Node {
-	lhs := p.parseBitwiseAnd()
+func (p *Parser) parseStatement() (ast.Node, error) {
+	if p.see(token.IDENT) && p.peek(1).Kind() == token.ASSIGN {
+		return p.parseAssignment()
+	}
+	if p.seeDefinition() {
+		return p.parseDefinition()
+	}
+	return p.parseExpression()
+}
 
-	for {
-		if p.have(token.XOR) {
-			lhs = ast.NewBitwiseXorOp(lhs, p.parseBitwiseAnd())
-		} else {
-			break
+// seeDefinition reports whether the upcoming tokens are the head of a
+// function definition, i.e. IDENT ( [IDENT {, IDENT}] ) =
+func (p *Parser) seeDefinition() bool {
+	if !p.see(token.IDENT) || p.peek(1).Kind() != token.LPAR {
+		return false
+	}
+	m, depth, prev := p.ts.Mark(), p.depth, p.prev
+	defer func() {
+		p.ts.Reset(m)
+		p.depth, p.prev = depth, prev
+	}()
+	p.pop()
+	p.pop()
+	if p.have(token.RPAR) {
+		return p.see(token.ASSIGN)
+	}
+	for p.have(token.IDENT) {
+		if p.have(token.RPAR) {
+			return p.see(token.ASSIGN)
+		}
+		if !p.have(token.COMMA) {
+			return false
 		}
 	}
-	return lhs
+	return false
 }
 
-func (p *Parser) parseBitwiseAnd() ast.Node {
-	lhs := p.parsePlus()
-
-	for {
-		if p.have(token.AND) {
-			lhs = ast.NewBitwiseAndOp(lhs, p.parsePlus())
-		} else {
+func (p *Parser) parseDefinition() (ast.Node, error) {
+	name, err := p.expect(token.IDENT)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(token.LPAR); err != nil {
+		return nil, err
+	}
+	scope := p.scope.Child()
+	var params []*ast.Variable
+	for !p.see(token.RPAR) {
+		t, err := p.expect(token.IDENT)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range params {
+			if v.Name == t.String() {
+				return nil, &SyntaxError{
+					Kind:  DuplicateParameter,
+					Span:  t.Span(),
+					Found: t,
+				}
+			}
+		}
+		params = append(params, scope.Define(t.String()))
+		if !p.have(token.COMMA) {
 			break
 		}
 	}
-	return lhs
+	if _, err := p.expect(token.RPAR); err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(token.ASSIGN); err != nil {
+		return nil, err
+	}
+
+	// the function is defined before the body is parsed to allow recursion
+	fn := p.scope.DefineFunc(name.String(), params)
+
+	outer := p.scope
+	p.scope = scope
+	body, err := p.parseExpression()
+	p.scope = outer
+
+	if err != nil {
+		return nil, err
+	}
+	fn.Body = body
+	return p.node(ast.NewDefineExp(fn), name.Span()), nil
 }
 
-func (p *Parser) parsePlus() ast.Node {
-	lhs := p.parseMul()
+func (p *Parser) parseAssignment() (ast.Node, error) {
+	name, err := p.expect(token.IDENT)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(token.ASSIGN); err != nil {
+		return nil, err
+	}
+	exp, err := p.parseExpression()
+	v := p.scope.Define(name.String())
+	if err != nil {
+		// the variable is defined anyway to avoid follow-up errors
+		return nil, err
+	}
+	return p.node(ast.NewAssignExp(v, exp), name.Span()), nil
+}
 
-	for {
-		if p.have(token.PLUS) {
-			lhs = ast.NewPlusOp(lhs, p.parseMul())
-		} else if p.have(token.MINUS) {
-			lhs = ast.NewMinusOp(lhs, p.parseMul())
-		} else {
-			break
+func (p *Parser) parseExpression() (ast.Node, error) {
+	return p.parseConditional()
+}
+
+// parseConditional parses the ternary operator, which is right associative
+func (p *Parser) parseConditional() (ast.Node, error) {
+	cond, err := p.parseOperators(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.have(token.QUESTION) {
+		then, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(token.COLON); err != nil {
+			return nil, err
+		}
+		els, err := p.parseConditional()
+		if err != nil {
+			return nil, err
 		}
+		return p.node(ast.NewCondExp(cond, then, els), cond.Span()), nil
+	}
+	return cond, nil
+}
+
+// parseIf parses an if-then-else expression, whose else branch extends as
+// far as possible
+func (p *Parser) parseIf() (ast.Node, error) {
+	t := p.last()
+	cond, err := p.parseExpression()
+	if err != nil {
+		return nil, err
 	}
-	return lhs
+	if _, err := p.expect(token.THEN); err != nil {
+		return nil, err
+	}
+	then, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(token.ELSE); err != nil {
+		return nil, err
+	}
+	els, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	return p.node(ast.NewCondExp(cond, then, els), t.Span()), nil
 }
 
-func (p *Parser) parseMul() ast.Node {
-	lhs := p.parsePow()
+// parseOperators parses an expression of operators by precedence climbing.
+// Only infix and postfix operators of at least the given precedence are
+// parsed, such that the caller may continue with operators of lower
+// precedence.
+func (p *Parser) parseOperators(prec int) (ast.Node, error) {
+	lhs, err := p.parsePrefix()
+	if err != nil {
+		return nil, err
+	}
 
 	for {
-		if p.have(token.MUL) {
-			lhs = ast.NewMulOp(lhs, p.parsePow())
-		} else if p.have(token.DIV) {
-			lhs = ast.NewDivOp(lhs, p.parsePow())
-		} else if p.have(token.MOD) {
-			lhs = ast.NewModOp(lhs, p.parsePow())
-		} else {
+		if op, ok := p.operator(Postfix); ok && op.Precedence >= prec {
+			p.pop()
+			lhs = p.node(op.Unary(lhs), lhs.Span())
+			continue
+		}
+		op, ok := p.operator(Infix)
+		if !ok && p.seeImplicit() && p.implicit >= prec {
+			rhs, err := p.parseOperators(p.implicit + 1)
+			if err != nil {
+				return nil, err
+			}
+			lhs = p.node(ast.NewMulOp(lhs, rhs), lhs.Span())
+			continue
+		}
+		if !ok || op.Precedence < prec {
 			break
 		}
+		p.pop()
+		next := op.Precedence + 1
+		if op.Assoc == RightAssoc {
+			next = op.Precedence
+		}
+		rhs, err := p.parseOperators(next)
+		if err != nil {
+			return nil, err
+		}
+		lhs = p.node(op.Binary(lhs, rhs), lhs.Span())
 	}
-	return lhs
+	return lhs, nil
 }
 
-func (p *Parser) parsePow() ast.Node {
-	lhs := p.parseAtomic()
+// parsePrefix parses a prefix operator and its operand, which extends over
+// operators of at least the precedence of the prefix operator
+func (p *Parser) parsePrefix() (ast.Node, error) {
+	op, ok := p.operator(Prefix)
+	if !ok {
+		return p.parseAtomic()
+	}
+	p.pop()
+	t := p.last()
+	exp, err := p.parseOperators(op.Precedence)
+	if err != nil {
+		return nil, err
+	}
+	return p.node(op.Unary(exp), t.Span()), nil
+}
+
+// seeImplicit reports whether the current token starts the right-hand side
+// of an implicit multiplication. To avoid ambiguity, it must be an
+// identifier, a parenthesis or a prefix operator which is not also an infix
+// operator, but not a number, such that 2 3 is an error.
+func (p *Parser) seeImplicit() bool {
+	if p.implicit == 0 {
+		return false
+	}
+	_, prefix := p.operator(Prefix)
+	return p.see(token.IDENT) || p.see(token.LPAR) || prefix
+}
 
-	for p.have(token.POW) {
-		lhs = ast.NewPowOp(lhs, p.parseAtomic())
+// operator returns the operator of the given fixity denoted by the current
+// token, if any
+func (p *Parser) operator(fixity Fixity) (Operator, bool) {
+	t := p.current()
+	if !t.Kind().IsSymbol() {
+		return Operator{}, false
 	}
-	return lhs
+	symbol := t.Kind().Symbol()
+	if t.Kind() == token.OPERATOR {
+		symbol = t.String()
+	}
+	op, ok := p.reg.operator(symbol, fixity)
+	if ok && p.legacy {
+		op = legacyOperator(op)
+	}
+	return op, ok
 }
 
-func (p *Parser) parseAtomic() ast.Node {
-	if p.have(token.MINUS) {
-		return ast.NewNegOp(p.parseAtomic())
+func (p *Parser) parseAtomic() (ast.Node, error) {
+	if p.have(token.IF) {
+		return p.parseIf()
 	} else if p.have(token.LPAR) {
-		exp := p.parseExpression()
-		p.expect(token.RPAR)
-		return exp
+		t := p.last()
+		exp, err := p.parseExpression()
+		if err != nil {
+			p.report(err)
+			p.sync(token.RPAR)
+			exp = p.node(ast.NewBadExp(), t.Span())
+		}
+		if _, err := p.expect(token.RPAR); err != nil {
+			return nil, err
+		}
+		return exp, nil
 	} else if p.have(token.IDENT) {
-		if p.see(token.LPAR) {
+		if p.see(token.LPAR) && !p.seeImplicitOperand() {
 			return p.parseFunc()
 		}
-		return p.parseConstant()
+		return p.parseIdent()
+	} else if p.have(token.ILLEGAL) {
+		// already reported by the scanner
+		return p.node(ast.NewBadExp(), p.last().Span()), nil
 	} else {
 		return p.parseNumber()
 	}
 }
 
-func (p *Parser) parseNumber() ast.Node {
+func (p *Parser) invalidLiteral(t *token.Token, err error) error {
+	return &SyntaxError{
+		Kind:  InvalidLiteral,
+		Span:  t.Span(),
+		Found: t,
+		Err:   err,
+	}
+}
+
+func (p *Parser) parseNumber() (ast.Node, error) {
 	if p.have(token.FLOAT_LITERAL) {
 		t := p.last()
-		i, err := strconv.ParseFloat(t.String(), 64)
+		n, err := ast.NewDecimalLiteral(digits(t))
 		if err != nil {
-			panic(err)
+			return nil, p.invalidLiteral(t, err)
 		}
-		return ast.NewFloatLiteral(i)
+		return p.node(n, t.Span()), nil
 	} else if p.have(token.INT_LITERAL) {
-		t := p.last()
-		i, err := strconv.ParseUint(t.String(), 10, 64)
-		if err != nil {
-			panic(err)
-		}
-		return ast.NewIntegerLiteral(float64(i))
+		return p.parseInteger(p.last(), digits(p.last()), 10)
 	} else if p.have(token.HEX_LITERAL) {
-		t := p.last()
-		i, err := strconv.ParseUint(t.String()[2:], 16, 64)
-		if err != nil {
-			panic(err)
-		}
-		return ast.NewIntegerLiteral(float64(i))
+		return p.parseInteger(p.last(), digits(p.last())[2:], 16)
 	} else if p.have(token.BIN_LITERAL) {
+		return p.parseInteger(p.last(), digits(p.last())[2:], 2)
+	} else if p.have(token.OCT_LITERAL) {
+		return p.parseInteger(p.last(), digits(p.last())[2:], 8)
+	} else if p.have(token.IMAG_LITERAL) {
 		t := p.last()
-		i, err := strconv.ParseUint(t.String()[2:], 2, 64)
+		text := digits(t)
+		n, err := strconv.ParseFloat(text[:len(text)-1], 64)
 		if err != nil {
-			panic(err)
+			return nil, p.invalidLiteral(t, err)
+		}
+		return p.node(ast.NewImaginaryLiteral(n), t.Span()), nil
+	}
+	return nil, p.unexpected()
+}
+
+// digits returns the text of a numeric literal without digit separators
+func digits(t *token.Token) string {
+	return strings.ReplaceAll(t.String(), "_", "")
+}
+
+// parseInteger parses the digits of an integer literal. Literals which do
+// not fit in 64 bits are parsed with arbitrary precision.
+func (p *Parser) parseInteger(t *token.Token, digits string, base int) (ast.Node, error) {
+	i, err := strconv.ParseUint(digits, base, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		if x, ok := new(big.Int).SetString(digits, base); ok {
+			return p.node(ast.NewBigIntegerLiteral(x), t.Span()), nil
 		}
-		return ast.NewIntegerLiteral(float64(i))
 	}
-	panic(fmt.Sprintf("unexpected token: %s\n", p.current().Kind().String()))
+	if err != nil {
+		return nil, p.invalidLiteral(t, err)
+	}
+	return p.node(ast.NewIntegerLiteral(i), t.Span()), nil
 }
 
-func (p *Parser) parseConstant() ast.Node {
+func (p *Parser) parseIdent() (ast.Node, error) {
 	t := p.last()
-	if c, ok := constants[t.String()]; ok {
-		return c()
+	if v := p.scope.Lookup(t.String()); v != nil {
+		return p.node(ast.NewVariableExp(v), t.Span()), nil
+	}
+	if c := p.constant(t.String()); c != nil {
+		return p.node(c(), t.Span()), nil
+	}
+	return nil, &SyntaxError{
+		Kind:  UndefinedIdentifier,
+		Span:  t.Span(),
+		Found: t,
 	}
-	panic(fmt.Sprintf("undefined constant: %s\n", t.String()))
 }
 
-func (p *Parser) parseFunc() ast.Node {
+func (p *Parser) parseFunc() (ast.Node, error) {
 	fn := p.last()
 
 	var params []ast.Node
-	p.expect(token.LPAR)
-	for {
-		exp := p.parseExpression()
-		if exp != nil {
-			params = append(params, exp)
+	if _, err := p.expect(token.LPAR); err != nil {
+		return nil, err
+	}
+	for !p.see(token.RPAR) {
+		start := p.current().Span()
+		exp, err := p.parseExpression()
+		if err != nil {
+			p.report(err)
+			p.sync(token.COMMA, token.RPAR)
+			exp = p.node(ast.NewBadExp(), start)
 		}
+		params = append(params, exp)
 		if !p.have(token.COMMA) {
 			break
 		}
 	}
-	p.expect(token.RPAR)
-	if f, ok := functions[fn.String()]; ok {
-		return f(params)
+	if _, err := p.expect(token.RPAR); err != nil {
+		return nil, err
+	}
+	if f := p.function(fn.String()); f != nil {
+		return p.node(f(params), fn.Span()), nil
 	}
-	panic(fmt.Sprintf("undefined function: %s\n", fn.String()))
+	return nil, &SyntaxError{
+		Kind:  UndefinedFunction,
+		Span:  fn.Span(),
+		Found: fn,
+	}
+}
+
+// function returns the factory for calls to the named function, or nil if
+// there is no such function. User functions shadow registered functions.
+func (p *Parser) function(name string) funcExpFactory {
+	if f := p.scope.LookupFunc(name); f != nil {
+		return f.Call
+	}
+	return p.reg.funcs[name]
+}
+
+// seeImplicitOperand reports whether the identifier just consumed names a
+// variable or constant rather than a function, such that a parenthesis
+// following it is an implicit multiplication, e.g. x(x+1)
+func (p *Parser) seeImplicitOperand() bool {
+	name := p.last().String()
+	if p.implicit == 0 || p.function(name) != nil {
+		return false
+	}
+	return p.scope.Lookup(name) != nil || p.constant(name) != nil
+}
+
+// constant returns the factory for the named constant, or nil if there is
+// no such constant
+func (p *Parser) constant(name string) constFactory {
+	return p.reg.consts[name]
 }
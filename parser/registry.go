@@ -0,0 +1,170 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/tympanix/gocalc/ast"
+)
+
+type funcExpFactory func(params []ast.Node) ast.Node
+type constFactory func() ast.Node
+
+// builtin functions and constants, which are cloned into every new registry
+var (
+	functions = map[string]funcExpFactory{
+		"sqrt":      ast.NewSqrtOp,
+		"log":       ast.NewLog10Op,
+		"log10":     ast.NewLog10Op,
+		"log2":      ast.NewLog2Op,
+		"pow":       ast.NewPowFnOp,
+		"sin":       ast.NewSinOp,
+		"cos":       ast.NewCosOp,
+		"tan":       ast.NewTanOp,
+		"asin":      ast.NewAsinOp,
+		"acos":      ast.NewAcosOp,
+		"atan":      ast.NewAtanOp,
+		"ln":        ast.NewLnOp,
+		"exp":       ast.NewExpOp,
+		"abs":       ast.NewAbsOp,
+		"rad":       ast.NewRadOp,
+		"deg":       ast.NewDegOp,
+		"round":     ast.NewRoundOp,
+		"floor":     ast.NewFloorOp,
+		"ceil":      ast.NewCeilOp,
+		"factorial": ast.NewFactorialOp,
+		"re":        ast.NewReOp,
+		"im":        ast.NewImOp,
+		"conj":      ast.NewConjOp,
+		"arg":       ast.NewArgOp,
+		"piecewise": ast.NewPiecewiseOp,
+	}
+
+	constants = map[string]constFactory{
+		"pi": ast.NewPiOp,
+		"π":  ast.NewPiOp,
+		"e":  ast.NewEulerOp,
+		"i":  ast.NewImaginaryUnitOp,
+	}
+)
+
+// Registry holds the functions, constants and operators available to a parser
+type Registry struct {
+	funcs  map[string]funcExpFactory
+	consts map[string]constFactory
+	ops    map[opKey]Operator
+}
+
+// NewRegistry returns a new registry with the builtin functions, constants
+// and operators
+func NewRegistry() *Registry {
+	builtins := &Registry{funcs: functions, consts: constants, ops: map[opKey]Operator{}}
+	for _, op := range operators {
+		builtins.RegisterOperator(op)
+	}
+	return builtins.Clone()
+}
+
+// Clone returns a copy of the registry
+func (r *Registry) Clone() *Registry {
+	c := &Registry{
+		funcs:  make(map[string]funcExpFactory, len(r.funcs)),
+		consts: make(map[string]constFactory, len(r.consts)),
+		ops:    make(map[opKey]Operator, len(r.ops)),
+	}
+	for name, f := range r.funcs {
+		c.funcs[name] = f
+	}
+	for name, k := range r.consts {
+		c.consts[name] = k
+	}
+	for key, op := range r.ops {
+		c.ops[key] = op
+	}
+	return c
+}
+
+// RegisterFunc registers a function with the given signature, which calls
+// impl with the values of the parameters. Any function of the same name is
+// shadowed. It fails if the signature is not valid.
+func (r *Registry) RegisterFunc(name string, sig ast.Signature, impl func(args []float64) float64) error {
+	if err := sig.Validate(); err != nil {
+		return fmt.Errorf("function %s: %v", name, err)
+	}
+	r.funcs[name] = ast.NewNativeFunc(name, sig, impl)
+	return nil
+}
+
+// RegisterConst registers a constant of the given type, shadowing any
+// constant of the same name
+func (r *Registry) RegisterConst(name string, t ast.Type, value float64) {
+	r.consts[name] = func() ast.Node {
+		return ast.NewConstantOp(name, t, value)
+	}
+}
+
+// RegisterOperator registers an operator, shadowing any operator of the same
+// symbol and fixity
+func (r *Registry) RegisterOperator(op Operator) {
+	r.ops[opKey{op.Symbol, op.Fixity}] = op
+}
+
+// RemoveFunc removes the named function from the registry
+func (r *Registry) RemoveFunc(name string) {
+	delete(r.funcs, name)
+}
+
+// RemoveConst removes the named constant from the registry
+func (r *Registry) RemoveConst(name string) {
+	delete(r.consts, name)
+}
+
+// RemoveOperator removes the operator of the given symbol and fixity from the
+// registry
+func (r *Registry) RemoveOperator(symbol string, fixity Fixity) {
+	delete(r.ops, opKey{symbol, fixity})
+}
+
+// operator returns the operator of the given symbol and fixity
+func (r *Registry) operator(symbol string, fixity Fixity) (Operator, bool) {
+	op, ok := r.ops[opKey{symbol, fixity}]
+	return op, ok
+}
+
+// Funcs returns the names of the registered functions in sorted order
+func (r *Registry) Funcs() []string {
+	names := make([]string, 0, len(r.funcs))
+	for name := range r.funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Consts returns the names of the registered constants in sorted order
+func (r *Registry) Consts() []string {
+	names := make([]string, 0, len(r.consts))
+	for name := range r.consts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Operators returns the registered operators ordered by precedence
+func (r *Registry) Operators() []Operator {
+	ops := make([]Operator, 0, len(r.ops))
+	for _, op := range r.ops {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if ops[i].Precedence != ops[j].Precedence {
+			return ops[i].Precedence < ops[j].Precedence
+		}
+		if ops[i].Symbol != ops[j].Symbol {
+			return ops[i].Symbol < ops[j].Symbol
+		}
+		return ops[i].Fixity < ops[j].Fixity
+	})
+	return ops
+}
@@ -0,0 +1,301 @@
+package scanner
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tympanix/gocalc/scanner/token"
+)
+
+// lookahead is the number of bytes the scanner may inspect beyond the end of
+// a token to decide where it ends, e.g. to tell the exponent of 2e3 from the
+// identifier of 2exp(1)
+const lookahead = 3 * utf8.UTFMax
+
+// Edit replaces Removed bytes of a source text at Offset by Text
+type Edit struct {
+	Offset  int
+	Removed int
+	Text    string
+}
+
+// Buffer holds the tokens of a source text, which are updated incrementally
+// as the text is edited. Only the tokens around an edit are scanned again,
+// while the following tokens are retained with their positions adjusted,
+// such that editors may scan the text on every keystroke.
+type Buffer struct {
+	src   string
+	items []item
+	// setup configures every scanner of the buffer, e.g. to keep trivia
+	setup func(*Scanner)
+	// reach is the number of bytes beyond the end of a token which may
+	// affect its scanning
+	reach int
+}
+
+// NewBuffer scans the source text. The setup function, which may be nil,
+// configures the scanners of the buffer before scanning.
+func NewBuffer(src string, setup func(*Scanner)) *Buffer {
+	b := &Buffer{setup: setup}
+	s := b.scanner(src, token.Pos{Offset: 0, Line: 1, Column: 1}, nil)
+	b.reach = lookahead
+	if len(s.defined) > 0 && len(s.defined[0]) > b.reach {
+		b.reach = len(s.defined[0])
+	}
+	b.src = src
+	b.items = scanAll(s)
+	return b
+}
+
+// scanner returns a scanner of the source text from the position pos, which
+// continues after the token prev, if any
+func (b *Buffer) scanner(src string, pos token.Pos, prev *token.Token) *Scanner {
+	s := newScanner(bufio.NewReader(strings.NewReader(src[pos.Offset:])))
+	s.pos, s.start = pos, pos
+	if b.setup != nil {
+		b.setup(s)
+	}
+	if prev != nil {
+		s.last = prev
+		s.terminates = s.ends(prev)
+		s.blank = prev.Kind() == token.NEWLINE && prev.String() == "\n"
+	}
+	return s
+}
+
+// scanAll scans the tokens up to and including EOF
+func scanAll(s *Scanner) []item {
+	var items []item
+	for {
+		t, err := s.NextToken()
+		if err != nil {
+			t = illegal(err)
+		}
+		items = append(items, item{t, err})
+		if t.Kind() == token.EOF {
+			return items
+		}
+	}
+}
+
+// Source returns the source text
+func (b *Buffer) Source() string {
+	return b.src
+}
+
+// Tokens returns the tokens of the source text ending with EOF. Erroneous
+// input is represented by ILLEGAL tokens.
+func (b *Buffer) Tokens() []*token.Token {
+	tokens := make([]*token.Token, len(b.items))
+	for i, it := range b.items {
+		tokens[i] = it.tok
+	}
+	return tokens
+}
+
+// Errors returns the errors encountered while scanning
+func (b *Buffer) Errors() []error {
+	var errs []error
+	for _, it := range b.items {
+		if it.err != nil {
+			errs = append(errs, it.err)
+		}
+	}
+	return errs
+}
+
+// Stream returns a stream of the tokens of the buffer
+func (b *Buffer) Stream() *Stream {
+	return NewStream(&replay{items: b.items})
+}
+
+// replay is a source of previously scanned tokens
+type replay struct {
+	items []item
+}
+
+func (r *replay) NextToken() (*token.Token, error) {
+	it := r.items[0]
+	if len(r.items) > 1 {
+		r.items = r.items[1:]
+	}
+	if it.err != nil {
+		return nil, it.err
+	}
+	return it.tok, nil
+}
+
+// Update applies the edit to the source text and scans the affected tokens
+// again. It returns the range [start, end) of the rescanned tokens in the
+// updated token list. The tokens before start and the tokens from end on
+// are retained, such that the rescanned tokens replace the range
+// [start, end+n-m) of the previous list of n tokens, where m is the length
+// of the updated list. The edit must not split a character encoded in
+// several bytes.
+func (b *Buffer) Update(e Edit) (start, end int, err error) {
+	if e.Offset < 0 || e.Removed < 0 || e.Offset+e.Removed > len(b.src) {
+		return 0, 0, errors.New("edit out of range")
+	}
+	src := b.src[:e.Offset] + e.Text + b.src[e.Offset+e.Removed:]
+	delta := len(e.Text) - e.Removed
+
+	// scanning restarts after the last token which is unaffected by the
+	// edit, such that its trailing comments are scanned again
+	k := 0
+	for k < len(b.items)-1 && b.end(b.items[k])+b.reach <= e.Offset {
+		k++
+	}
+	// trivia preceding erroneous input are attached to the next token, such
+	// that scanning can not restart after an error
+	for k > 0 && b.items[k-1].err != nil {
+		k--
+	}
+	pos := token.Pos{Offset: 0, Line: 1, Column: 1}
+	var prev *token.Token
+	if k > 0 {
+		prev = clearTrailing(b.items[k-1].tok)
+		pos = prev.Span().End
+	}
+	s := b.scanner(src, pos, prev)
+
+	sh := shift{
+		from: advance(pos, b.src[pos.Offset:e.Offset+e.Removed]),
+		to:   advance(pos, src[pos.Offset:e.Offset+len(e.Text)]),
+	}
+
+	items := append([]item(nil), b.items[:k]...)
+	start = len(items)
+	if prev != nil {
+		items[k-1].tok = prev
+		start--
+	}
+	j := k
+	last, lastErr := prev, error(nil)
+	for {
+		t, err := s.NextToken()
+		if err != nil {
+			t = illegal(err)
+		}
+		// once the gap before a token lies after the edit, the remaining
+		// tokens are unchanged if the token and its predecessor match.
+		// Trivia are only attached to tokens of valid input, such that
+		// neither may be erroneous.
+		if last != nil && lastErr == nil && err == nil && last.Span().End.Offset >= sh.to.Offset {
+			for j < len(b.items) && b.items[j].tok.Span().Start.Offset+delta < t.Span().Start.Offset {
+				j++
+			}
+			if j > k && j < len(b.items) && b.items[j-1].err == nil && matches(b.items[j].tok, t, delta) && follows(s, b.items[j-1].tok, last, delta) {
+				end = len(items)
+				for _, it := range b.items[j:] {
+					items = append(items, sh.item(it))
+				}
+				b.src, b.items = src, items
+				return start, end, nil
+			}
+		}
+		items = append(items, item{t, err})
+		if t.Kind() == token.EOF {
+			b.src, b.items = src, items
+			return start, len(items), nil
+		}
+		last, lastErr = t, err
+	}
+}
+
+// end returns the offset where scanning of the item ended. The error of an
+// unterminated comment refers to its opening delimiter, while the comment
+// extends to the end of input.
+func (b *Buffer) end(it item) int {
+	if e, ok := it.err.(*Error); ok && e.Kind == UnterminatedComment {
+		return len(b.src)
+	}
+	return it.tok.Span().End.Offset
+}
+
+// clearTrailing returns a copy of the token without trailing trivia
+func clearTrailing(t *token.Token) *token.Token {
+	c := token.New(t.Kind(), t.String(), t.Span())
+	c.AddLeading(t.Leading()...)
+	return c
+}
+
+// matches reports whether the new token equals the old token moved by delta
+// bytes
+func matches(old, t *token.Token, delta int) bool {
+	return old.Kind() == t.Kind() && old.String() == t.String() && old.Span().Start.Offset+delta == t.Span().Start.Offset
+}
+
+// follows reports whether the new token ends where the old token moved by
+// delta bytes ends, and the scanner s continues in the same state after
+// both. Comments never trail line breaks, such that both must be line breaks
+// or neither.
+func follows(s *Scanner, old, t *token.Token, delta int) bool {
+	blank := func(t *token.Token) bool {
+		return t.Kind() == token.NEWLINE && t.String() == "\n"
+	}
+	return old.Span().End.Offset+delta == t.Span().End.Offset &&
+		s.ends(old) == s.ends(t) && blank(old) == blank(t) &&
+		(old.Kind() == token.NEWLINE) == (t.Kind() == token.NEWLINE)
+}
+
+// advance returns the position after text starting at pos
+func advance(pos token.Pos, text string) token.Pos {
+	for _, r := range text {
+		pos.Offset += utf8.RuneLen(r)
+		if r == '\n' {
+			pos.Line++
+			pos.Column = 1
+		} else {
+			pos.Column++
+		}
+	}
+	return pos
+}
+
+// shift moves positions after an edit, which ended at from before the edit
+// and ends at to after it
+type shift struct {
+	from token.Pos
+	to   token.Pos
+}
+
+// pos moves a position after the edit
+func (sh shift) pos(p token.Pos) token.Pos {
+	if p.Line == sh.from.Line {
+		p.Column += sh.to.Column - sh.from.Column
+	}
+	p.Line += sh.to.Line - sh.from.Line
+	p.Offset += sh.to.Offset - sh.from.Offset
+	return p
+}
+
+func (sh shift) span(s token.Span) token.Span {
+	return token.Span{Start: sh.pos(s.Start), End: sh.pos(s.End)}
+}
+
+func (sh shift) trivia(trivia []token.Trivia) []token.Trivia {
+	var moved []token.Trivia
+	for _, tr := range trivia {
+		tr.Span = sh.span(tr.Span)
+		moved = append(moved, tr)
+	}
+	return moved
+}
+
+// item moves a token and its error after the edit
+func (sh shift) item(it item) item {
+	if sh.from == sh.to {
+		return it
+	}
+	t := token.New(it.tok.Kind(), it.tok.String(), sh.span(it.tok.Span()))
+	t.AddLeading(sh.trivia(it.tok.Leading())...)
+	t.AddTrailing(sh.trivia(it.tok.Trailing())...)
+	if e, ok := it.err.(*Error); ok {
+		moved := *e
+		moved.Span = sh.span(e.Span)
+		return item{t, &moved}
+	}
+	return item{t, it.err}
+}
@@ -0,0 +1,44 @@
+package scanner
+
+import (
+	"fmt"
+
+	"github.com/tympanix/gocalc/scanner/token"
+)
+
+// ErrorKind classifies errors encountered while scanning
+type ErrorKind int
+
+const (
+	// UnknownToken is reported for input which does not start any token
+	UnknownToken ErrorKind = iota
+	// MalformedLiteral is reported for numeric literals which are invalid
+	MalformedLiteral
+	// UnterminatedComment is reported for block comments which are not
+	// closed before the end of input
+	UnterminatedComment
+)
+
+// Error is an error encountered while scanning the input
+type Error struct {
+	Kind ErrorKind
+	Span token.Span
+	Text string
+	// Reason explains why a literal is malformed
+	Reason string
+}
+
+// Error returns the error message prefixed with the position
+func (e *Error) Error() string {
+	switch e.Kind {
+	case MalformedLiteral:
+		if e.Reason != "" {
+			return fmt.Sprintf("%s: malformed literal: %s: %s", e.Span, e.Text, e.Reason)
+		}
+		return fmt.Sprintf("%s: malformed literal: %s", e.Span, e.Text)
+	case UnterminatedComment:
+		return fmt.Sprintf("%s: unterminated comment", e.Span)
+	default:
+		return fmt.Sprintf("%s: unknown token: %s", e.Span, e.Text)
+	}
+}
@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/tympanix/gocalc/scanner/token"
 )
@@ -26,14 +28,75 @@ var (
 		'(': token.LPAR,
 		')': token.RPAR,
 		',': token.COMMA,
+		'=': token.ASSIGN,
+		';': token.SEMICOLON,
+		'<': token.LSS,
+		'>': token.GTR,
+		'!': token.NOT,
+		'~': token.TILDE,
+		'?': token.QUESTION,
+		':': token.COLON,
+		'√': token.ROOT,
+		'²': token.SQUARE,
+		'³': token.CUBE,
+
+		// aliases of the ASCII symbols
+		'×': token.MUL,
+		'÷': token.DIV,
+		'−': token.MINUS,
+	}
+
+	keywords = map[string]token.Kind{
+		"if":   token.IF,
+		"then": token.THEN,
+		"else": token.ELSE,
+	}
+
+	// operators are symbols of several characters, which take precedence
+	// over the symbols of a single character. The longest operator matching
+	// the input is scanned, e.g. >>> rather than >> followed by >.
+	operators = map[string]token.Kind{
+		"==":  token.EQL,
+		"!=":  token.NEQ,
+		"<=":  token.LEQ,
+		">=":  token.GEQ,
+		"&&":  token.LAND,
+		"||":  token.LOR,
+		"<<":  token.SHL,
+		">>":  token.SHR,
+		">>>": token.USHR,
+
+		// aliases of the operators
+		"**": token.POW,
 	}
 )
 
 // Scanner is able to scan input files
 type Scanner struct {
-	r   *bufio.Reader
-	buf bytes.Buffer
-	i   int
+	r     *bufio.Reader
+	buf   bytes.Buffer
+	i     int
+	pos   token.Pos
+	start token.Pos
+
+	// terminates is set when the last token may end a statement, in which
+	// case a line break is scanned as a NEWLINE token
+	terminates bool
+
+	// defined holds the symbols declared by Define, longest first
+	defined []string
+	// postfix holds the symbols of postfix operators, which may end a
+	// statement
+	postfix map[string]bool
+
+	// trivia is set if comments and blank lines are attached to the tokens
+	trivia bool
+	// pending holds the trivia scanned since the last token
+	pending []token.Trivia
+	// last is the last token scanned, which receives trailing comments
+	last *token.Token
+	// blank is set while the current line holds whitespace only
+	blank bool
 }
 
 // NewFromFile creates a new scanner from a file path
@@ -45,31 +108,128 @@ func NewFromFile(path string) (*Scanner, error) {
 		return nil, err
 	}
 
-	return &Scanner{
-		r: bufio.NewReader(f),
-	}, nil
+	return newScanner(bufio.NewReader(f)), nil
 }
 
 // NewFromReader returns a new scanner from a io.Reader object
 func NewFromReader(r io.Reader) *Scanner {
-	return &Scanner{
-		r: bufio.NewReader(r),
-	}
+	return newScanner(bufio.NewReader(r))
 }
 
 // NewFromString returns a new scanner from a string
 func NewFromString(str string) *Scanner {
+	return newScanner(bufio.NewReader(strings.NewReader(str)))
+}
+
+// Define declares an additional symbol, which is scanned as an OPERATOR
+// token. Defined symbols take precedence over the builtin symbols, and the
+// longest defined symbol matching the input is scanned. Symbols should
+// consist of punctuation only. Symbols which are already scanned as builtin
+// tokens are ignored.
+func (s *Scanner) Define(symbol string) {
+	if len(symbol) == 0 || operators[symbol] != 0 {
+		return
+	}
+	if r := []rune(symbol); len(r) == 1 && symbols[r[0]] != 0 {
+		return
+	}
+	for _, d := range s.defined {
+		if d == symbol {
+			return
+		}
+	}
+	s.defined = append(s.defined, symbol)
+	sort.SliceStable(s.defined, func(i, j int) bool {
+		return len(s.defined[i]) > len(s.defined[j])
+	})
+}
+
+// DefinePostfix declares a symbol like Define, which is the symbol of a
+// postfix operator, such that it may end a statement. The symbol may be
+// that of a builtin token.
+func (s *Scanner) DefinePostfix(symbol string) {
+	s.Define(symbol)
+	if s.postfix == nil {
+		s.postfix = make(map[string]bool)
+	}
+	s.postfix[symbol] = true
+}
+
+// SetTrivia enables attaching comments and blank lines to the tokens as
+// trivia, such that the source can be reproduced with its annotations.
+// Comments starting on the line of a token trail it, while other comments
+// and blank lines lead the next token, which is the EOF token at the end of
+// the input.
+func (s *Scanner) SetTrivia(keep bool) {
+	s.trivia = keep
+}
+
+// scanDefined scans the longest defined symbol matching the input
+func (s *Scanner) scanDefined() bool {
+	for _, d := range s.defined {
+		if s.hasString(d) {
+			return true
+		}
+	}
+	return false
+}
+
+// seeDefined reports whether a defined symbol starts at the input
+func (s *Scanner) seeDefined() bool {
+	for _, d := range s.defined {
+		if s.peek(len(d)) == d {
+			return true
+		}
+	}
+	return false
+}
+
+// scanOperator scans the longest operator of several characters matching
+// the input
+func (s *Scanner) scanOperator() (token.Kind, bool) {
+	var match string
+	for op := range operators {
+		if len(op) > len(match) && s.peek(len(op)) == op {
+			match = op
+		}
+	}
+	if match == "" {
+		return 0, false
+	}
+	s.nextN(utf8.RuneCountInString(match))
+	return operators[match], true
+}
+
+func newScanner(r *bufio.Reader) *Scanner {
+	pos := token.Pos{Offset: 0, Line: 1, Column: 1}
 	return &Scanner{
-		r: bufio.NewReader(strings.NewReader(str)),
+		r:     r,
+		pos:   pos,
+		start: pos,
+		blank: true,
+	}
+}
+
+func (s *Scanner) advance(r rune, size int) {
+	s.pos.Offset += size
+	if r == '\n' {
+		s.pos.Line++
+		s.pos.Column = 1
+	} else {
+		s.pos.Column++
 	}
 }
 
 func (s *Scanner) next() rune {
-	r, _, err := s.r.ReadRune()
+	r, size, err := s.r.ReadRune()
 	if err != nil {
 		return 0
 	}
+	if s.buf.Len() == 0 {
+		s.start = s.pos
+	}
 	s.buf.WriteRune(r)
+	s.advance(r, size)
 	return r
 }
 
@@ -87,20 +247,18 @@ func (s *Scanner) has(r rune) bool {
 	return false
 }
 
-func (s *Scanner) clear() {
-	s.buf.Reset()
-}
-
 func (s *Scanner) hasString(str string) bool {
 	if s.peek(len(str)) == str {
-		s.nextN(len(str))
+		s.nextN(utf8.RuneCountInString(str))
 		return true
 	}
 	return false
 }
 
+// hasDigit consumes a decimal digit. Only ASCII digits are accepted, such
+// that e.g. x² is the identifier x followed by the ² operator.
 func (s *Scanner) hasDigit() bool {
-	if unicode.IsNumber(s.peekRune()) {
+	if r := s.peekRune(); r >= '0' && r <= '9' {
 		s.next()
 		return true
 	}
@@ -116,19 +274,42 @@ func (s *Scanner) hasLetter() bool {
 }
 
 func (s *Scanner) discard() {
-	s.r.Discard(1)
+	r, size, err := s.r.ReadRune()
+	if err != nil {
+		return
+	}
+	s.advance(r, size)
 }
 
+// rune returns the first rune of the current token
 func (s *Scanner) rune() rune {
-	return rune(s.buf.Bytes()[0])
+	r, _ := utf8.DecodeRune(s.buf.Bytes())
+	return r
 }
 
+// peekRune returns the next rune of the input without consuming it, or 0 at
+// the end of input
 func (s *Scanner) peekRune() rune {
-	b, err := s.r.Peek(1)
-	if err != nil {
-		return 0
+	if r := s.peekRunes(1); len(r) > 0 {
+		return r[0]
+	}
+	return 0
+}
+
+// peekRunes returns up to n runes of the input without consuming them. Fewer
+// runes are returned at the end of input.
+func (s *Scanner) peekRunes(n int) []rune {
+	b, _ := s.r.Peek(n * utf8.UTFMax)
+	runes := make([]rune, 0, n)
+	for len(b) > 0 && len(runes) < n {
+		r, size := utf8.DecodeRune(b)
+		if r == utf8.RuneError && !utf8.FullRune(b) {
+			break
+		}
+		runes = append(runes, r)
+		b = b[size:]
 	}
-	return rune(b[0])
+	return runes
 }
 
 func (s *Scanner) peek(n int) string {
@@ -145,126 +326,353 @@ func (s *Scanner) get() string {
 	return str
 }
 
+func (s *Scanner) span() token.Span {
+	if s.buf.Len() == 0 {
+		s.start = s.pos
+	}
+	return token.Span{Start: s.start, End: s.pos}
+}
+
 func (s *Scanner) newToken(kind token.Kind) *token.Token {
-	return token.New(kind, s.get())
+	span := s.span()
+	if kind != token.NEWLINE {
+		s.blank = false
+	}
+	t := token.New(kind, s.get(), span)
+	s.terminates = s.ends(t)
+	s.attach(t)
+	return t
+}
+
+// terminates reports whether tokens of the kind may end a statement.
+// Erroneous input is assumed to do so.
+func terminates(kind token.Kind) bool {
+	switch kind {
+	case token.IDENT, token.INT_LITERAL, token.FLOAT_LITERAL, token.HEX_LITERAL, token.BIN_LITERAL, token.OCT_LITERAL, token.IMAG_LITERAL, token.RPAR, token.SQUARE, token.CUBE, token.ILLEGAL:
+		return true
+	}
+	return false
+}
+
+// ends reports whether the token may end a statement, which is the case for
+// the kinds of tokens which terminate and for postfix operators
+func (s *Scanner) ends(t *token.Token) bool {
+	if terminates(t.Kind()) {
+		return true
+	}
+	symbol := t.Kind().Symbol()
+	if t.Kind() == token.OPERATOR {
+		symbol = t.String()
+	}
+	return t.Kind().IsSymbol() && s.postfix[symbol]
+}
+
+// attach distributes the pending trivia among the last token and the new
+// token t. Comments starting on the line where the last token ends trail
+// it, while the remaining trivia lead t.
+func (s *Scanner) attach(t *token.Token) {
+	for _, tr := range s.pending {
+		if s.last != nil && s.last.Kind() != token.NEWLINE && tr.Kind != token.BlankLine && tr.Span.Start.Line == s.last.Span().End.Line {
+			s.last.AddTrailing(tr)
+		} else {
+			t.AddLeading(tr)
+		}
+	}
+	s.pending = nil
+	s.last = t
+}
+
+func (s *Scanner) error(kind ErrorKind) *Error {
+	span := s.span()
+	s.terminates = true
+	s.blank = false
+	return &Error{
+		Kind: kind,
+		Span: span,
+		Text: s.get(),
+	}
 }
 
-func (s *Scanner) unexpectedToken() {
-	panic(fmt.Sprintf("unknown token: %s\n", s.get()))
+// malformed returns the error for a malformed literal with the reason
+func (s *Scanner) malformed(reason string) *Error {
+	err := s.error(MalformedLiteral)
+	err.Reason = reason
+	return err
 }
 
-// NextToken retrieves the next token from the scanner
-func (s *Scanner) NextToken() *token.Token {
+// NextToken retrieves the next token from the scanner. Erroneous input is
+// consumed and reported as an *Error, such that scanning may continue.
+// Line breaks are only scanned as NEWLINE tokens if the preceding token may
+// end a statement, such that expressions may continue on the next line
+// after an operator.
+func (s *Scanner) NextToken() (*token.Token, error) {
 	for {
 		for unicode.IsSpace(s.peekRune()) {
+			if s.peekRune() == '\n' {
+				if s.terminates {
+					s.next()
+					t := s.newToken(token.NEWLINE)
+					s.blank = true
+					return t, nil
+				}
+				s.blankLine()
+			}
 			s.discard()
 		}
 
-		if s.has('0') {
-			if s.has('.') {
-				if !s.hasDigit() {
-					s.unexpectedToken()
-				}
-				if t := s.scanSciToken(); t != nil {
-					return t
-				}
-				return s.scanFloatToken()
-			} else if s.has('x') {
-				return s.scanHexToken()
-			} else if s.has('b') {
-				return s.scanBinToken()
-			} else if s.hasDigit() {
-				s.scanDigits()
-				panic(fmt.Sprintf("unknown token: %s\n", s.get()))
-			}
-			return s.newToken(token.INT_LITERAL)
-		} else if s.hasDigit() {
-			s.scanDigits()
-			if s.has('.') {
-				if t := s.scanSciToken(); t != nil {
-					return t
-				}
-				return s.scanFloatToken()
-			}
-			if t := s.scanSciToken(); t != nil {
-				return t
-			}
-			return s.scanIntToken()
-		} else if s.has('.') {
-			if t := s.scanSciToken(); t != nil {
-				return t
-			}
-			return s.scanFloatToken()
+		if s.scanDefined() {
+			return s.newToken(token.OPERATOR), nil
+		} else if r := s.peekRune(); r >= '0' && r <= '9' || r == '.' {
+			return s.scanNumber()
 		} else if s.hasLetter() {
 			for s.hasLetter() || s.hasDigit() {
 				// noop
 			}
-			return s.newToken(token.IDENT)
+			if t, ok := keywords[s.buf.String()]; ok {
+				return s.newToken(t), nil
+			}
+			return s.newToken(token.IDENT), nil
 		} else if s.hasString("//") {
-			s.clear()
-			for s.peekRune() != '\n' && s.peekRune() != 0 {
-				s.discard()
+			s.scanLineComment()
+		} else if s.hasString("/*") {
+			multiline, err := s.scanBlockComment()
+			if err != nil {
+				return nil, err
+			}
+			if multiline && s.terminates {
+				return s.newToken(token.NEWLINE), nil
 			}
+		} else if t, ok := s.scanOperator(); ok {
+			return s.newToken(t), nil
 		} else if t, ok := symbols[s.peekRune()]; ok {
 			s.next()
-			return s.newToken(t)
+			return s.newToken(t), nil
 		} else if s.has(0) {
-			return s.newToken(token.EOF)
+			return s.newToken(token.EOF), nil
 		} else {
-			panic(fmt.Sprintf("unknown token: %c\n", s.next()))
+			s.next()
+			return nil, s.error(UnknownToken)
 		}
 	}
 }
 
-func (s *Scanner) scanDigits() {
-	for {
-		if !s.hasDigit() {
-			break
+// scanLineComment scans a comment from // to the end of the line, excluding
+// the line break
+func (s *Scanner) scanLineComment() {
+	for s.peekRune() != '\n' && s.peekRune() != 0 {
+		s.next()
+	}
+	s.comment(token.LineComment)
+}
+
+// scanBlockComment scans a comment enclosed in /* and */, which may contain
+// nested block comments. It reports whether the comment spans several
+// lines, in which case it ends a statement like a line break.
+func (s *Scanner) scanBlockComment() (bool, error) {
+	for depth := 1; depth > 0; {
+		switch {
+		case s.hasString("/*"):
+			depth++
+		case s.hasString("*/"):
+			depth--
+		case s.peekRune() == 0:
+			err := s.error(UnterminatedComment)
+			err.Text = "/*"
+			err.Span.End = err.Span.Start
+			err.Span.End.Offset += 2
+			err.Span.End.Column += 2
+			return false, err
+		default:
+			s.next()
 		}
 	}
+	multiline := s.start.Line != s.pos.Line
+	s.comment(token.BlockComment)
+	return multiline, nil
 }
 
-func (s *Scanner) scanFloatToken() *token.Token {
-	s.scanDigits()
-	return s.newToken(token.FLOAT_LITERAL)
+// comment records the scanned comment as trivia, if enabled
+func (s *Scanner) comment(kind token.TriviaKind) {
+	span := s.span()
+	text := s.get()
+	s.blank = false
+	if s.trivia {
+		s.pending = append(s.pending, token.Trivia{Kind: kind, Text: text, Span: span})
+	}
 }
 
-func (s *Scanner) scanIntToken() *token.Token {
-	s.scanDigits()
-	return s.newToken(token.INT_LITERAL)
+// blankLine records the line break ahead as a blank line if the current
+// line holds whitespace only, and begins the next line
+func (s *Scanner) blankLine() {
+	if s.blank && s.trivia {
+		end := token.Pos{Offset: s.pos.Offset + 1, Line: s.pos.Line + 1, Column: 1}
+		s.pending = append(s.pending, token.Trivia{Kind: token.BlankLine, Span: token.Span{Start: s.pos, End: end}})
+	}
+	s.blank = true
 }
 
-func (s *Scanner) scanHexToken() *token.Token {
-	for {
-		if s.hasDigit() {
-			continue
+// scanNumber scans a numeric literal. Integers may be given in decimal, or
+// in hexadecimal, binary or octal with the prefixes 0x, 0b and 0o. Digits
+// may be separated by underscores. Decimal and hexadecimal numbers may have
+// a fraction and an exponent, where hexadecimal floats require an exponent
+// of the form p3. An e or p is only scanned as the exponent if it is not
+// followed by a letter, such that 2exp(1) is the number 2 followed by a
+// function call. Malformed literals are consumed and reported with the
+// reason.
+func (s *Scanner) scanNumber() (*token.Token, error) {
+	kind, base, name := token.INT_LITERAL, 10, "decimal"
+	if r := s.peekRunes(2); len(r) == 2 && r[0] == '0' {
+		switch unicode.ToLower(r[1]) {
+		case 'x':
+			kind, base, name = token.HEX_LITERAL, 16, "hexadecimal"
+		case 'b':
+			kind, base, name = token.BIN_LITERAL, 2, "binary"
+		case 'o':
+			kind, base, name = token.OCT_LITERAL, 8, "octal"
 		}
-		if s.peekRune() >= 'a' && s.peekRune() <= 'f' {
-			s.next()
-			continue
+		if base != 10 {
+			s.nextN(2)
 		}
-		if s.peekRune() >= 'A' && s.peekRune() <= 'F' {
-			s.next()
-			continue
+	}
+
+	var reason string
+	fail := func(format string, a ...interface{}) {
+		if reason == "" {
+			reason = fmt.Sprintf(format, a...)
 		}
-		return s.newToken(token.HEX_LITERAL)
+	}
+
+	digits, invalid := s.scanDigits(base)
+	if lit := strings.ReplaceAll(s.buf.String(), "_", ""); base == 10 && len(lit) > 1 && lit[0] == '0' {
+		fail("leading zero in decimal literal, use 0o for octal")
+	}
+	// a defined symbol such as .. takes precedence over the radix point
+	fraction := !s.seeDefined() && s.has('.')
+	if fraction {
+		if base != 10 && base != 16 {
+			fail("invalid radix point in %s literal", name)
+		}
+		n, inv := s.scanDigits(base)
+		if digits += n; invalid < 0 {
+			invalid = inv
+		}
+		if base == 10 {
+			kind = token.FLOAT_LITERAL
+		}
+	}
+	if digits == 0 {
+		fail("%s literal has no digits", name)
+	} else if invalid >= 0 {
+		fail("invalid digit %q in %s literal", invalid, name)
+	}
+
+	if s.seeExponent(base) {
+		s.next()
+		kind = token.FLOAT_LITERAL
+		if !s.has('+') {
+			s.has('-')
+		}
+		if n, _ := s.scanDigits(10); n == 0 {
+			fail("exponent has no digits")
+		}
+	} else if base == 16 && fraction {
+		fail("hexadecimal mantissa requires a 'p' exponent")
+	}
+
+	if !separated(s.buf.String()) {
+		fail("'_' must separate successive digits")
+	}
+	if reason != "" {
+		return nil, s.malformed(reason)
+	}
+	if base == 10 {
+		return s.scanImaginary(kind), nil
+	}
+	return s.newToken(kind), nil
+}
+
+// scanDigits consumes the digits of a number in the given base along with
+// underscores. Decimal digits are consumed in any base, such that an invalid
+// digit is reported as part of the literal. It returns the number of digits
+// and the first invalid digit, or -1 if there is none.
+func (s *Scanner) scanDigits(base int) (int, rune) {
+	n, invalid := 0, rune(-1)
+	for {
+		r := s.peekRune()
+		switch {
+		case r == '_':
+		case r >= '0' && r <= '9':
+			if int(r-'0') >= base && invalid < 0 {
+				invalid = r
+			}
+			n++
+		case base == 16 && isHex(r):
+			n++
+		default:
+			return n, invalid
+		}
+		s.next()
 	}
 }
 
-func (s *Scanner) scanBinToken() *token.Token {
-	for s.has('0') || s.has('1') {
-		// noop
+// seeExponent reports whether the input continues with the exponent of a
+// number in the given base
+func (s *Scanner) seeExponent(base int) bool {
+	r := s.peekRunes(2)
+	if len(r) == 0 {
+		return false
 	}
-	return s.newToken(token.BIN_LITERAL)
+	switch {
+	case base == 10 && (r[0] == 'e' || r[0] == 'E'):
+	case base == 16 && (r[0] == 'p' || r[0] == 'P'):
+	default:
+		return false
+	}
+	return len(r) == 1 || !unicode.IsLetter(r[1])
 }
 
-func (s *Scanner) scanSciToken() *token.Token {
-	s.scanDigits()
-	if s.has('e') || s.has('E') {
-		if s.has('-') || s.has('+') {
-			return s.scanFloatToken()
+// scanImaginary returns a token of the given kind for a decimal number, or
+// an imaginary literal if the number is suffixed by i or j
+func (s *Scanner) scanImaginary(kind token.Kind) *token.Token {
+	r := s.peekRunes(2)
+	if len(r) > 0 && (r[0] == 'i' || r[0] == 'j') {
+		if len(r) == 1 || !unicode.IsLetter(r[1]) && !unicode.IsDigit(r[1]) {
+			s.next()
+			return s.newToken(token.IMAG_LITERAL)
+		}
+	}
+	return s.newToken(kind)
+}
+
+func isHex(r rune) bool {
+	return r >= '0' && r <= '9' || r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F'
+}
+
+// separated reports whether every underscore of a numeric literal separates
+// successive digits. The base prefix counts as a digit, such that 0x_ff is
+// allowed.
+func separated(lit string) bool {
+	hex := false
+	digit := false
+	if len(lit) > 1 && lit[0] == '0' && strings.ContainsRune("xXbBoO", rune(lit[1])) {
+		hex = lit[1] == 'x' || lit[1] == 'X'
+		digit = true
+		lit = lit[2:]
+	}
+	sep := false
+	for _, r := range lit {
+		if r == '_' {
+			if !digit {
+				return false
+			}
+			sep, digit = true, false
+			continue
+		}
+		digit = r >= '0' && r <= '9' || hex && isHex(r)
+		if sep && !digit {
+			return false
 		}
-		return s.scanFloatToken()
+		sep = false
 	}
-	return nil
+	return !sep
 }
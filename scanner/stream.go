@@ -0,0 +1,112 @@
+package scanner
+
+import "github.com/tympanix/gocalc/scanner/token"
+
+// Source produces a sequence of tokens ending with an EOF token, like the
+// Scanner
+type Source interface {
+	NextToken() (*token.Token, error)
+}
+
+// item is a token of a stream along with the error of erroneous input
+type item struct {
+	tok *token.Token
+	err error
+}
+
+// Mark is a position in a stream, which the stream can be reset to
+type Mark int
+
+// Stream is a stream of tokens with arbitrary lookahead and backtracking.
+// Erroneous input is represented by an ILLEGAL token, which is returned
+// along with the error, such that consumers may continue. The EOF token is
+// repeated at the end of input.
+type Stream struct {
+	src Source
+	buf []item
+	// i is the index of the current token in buf
+	i int
+	// base is the number of tokens discarded from the front of buf
+	base int
+	// marks holds the outstanding marks in the order they were taken
+	marks []Mark
+}
+
+// NewStream returns a stream of the tokens of src
+func NewStream(src Source) *Stream {
+	return &Stream{src: src}
+}
+
+// illegal returns the ILLEGAL token representing the input of a scanner
+// error
+func illegal(err error) *token.Token {
+	if e, ok := err.(*Error); ok {
+		return token.New(token.ILLEGAL, e.Text, e.Span)
+	}
+	return token.New(token.ILLEGAL, "", token.Span{})
+}
+
+// at returns the item at index j of the buffer, scanning tokens as needed.
+// Indices beyond the end of input refer to the EOF token.
+func (s *Stream) at(j int) item {
+	for len(s.buf) <= j {
+		if n := len(s.buf); n > 0 && s.buf[n-1].tok.Kind() == token.EOF {
+			return s.buf[n-1]
+		}
+		t, err := s.src.NextToken()
+		if err != nil {
+			t = illegal(err)
+		}
+		s.buf = append(s.buf, item{t, err})
+	}
+	return s.buf[j]
+}
+
+// Peek returns the token n positions after the current token without
+// consuming it, such that Peek(0) returns the current token
+func (s *Stream) Peek(n int) (*token.Token, error) {
+	it := s.at(s.i + n)
+	return it.tok, it.err
+}
+
+// Next consumes and returns the current token. Tokens which can no longer
+// be reached by Reset are discarded.
+func (s *Stream) Next() (*token.Token, error) {
+	it := s.at(s.i)
+	if it.tok.Kind() != token.EOF {
+		s.i++
+	}
+	if len(s.marks) == 0 {
+		s.base += s.i
+		s.buf = s.buf[s.i:]
+		s.i = 0
+	}
+	return it.tok, it.err
+}
+
+// Mark returns the position of the current token, such that the stream can
+// be reset to it. Marks are nested: resetting or releasing a mark releases
+// the marks taken after it as well.
+func (s *Stream) Mark() Mark {
+	m := Mark(s.base + s.i)
+	s.marks = append(s.marks, m)
+	return m
+}
+
+// Reset rewinds the stream to the mark m and releases it. The mark must not
+// have been released before.
+func (s *Stream) Reset(m Mark) {
+	s.i = int(m) - s.base
+	s.Release(m)
+}
+
+// Release releases the mark m without rewinding the stream, such that the
+// tokens before it may be discarded
+func (s *Stream) Release(m Mark) {
+	for k := len(s.marks) - 1; k >= 0; k-- {
+		if s.marks[k] == m {
+			s.marks = s.marks[:k]
+			return
+		}
+	}
+}
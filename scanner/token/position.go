@@ -0,0 +1,95 @@
+package token
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Pos represents a position in the source
+type Pos struct {
+	Offset int // byte offset, starting at 0
+	Line   int // line number, starting at 1
+	Column int // column number in runes, starting at 1
+}
+
+// String returns the position formatted as line:column
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// IsValid reports whether the position has been set
+func (p Pos) IsValid() bool {
+	return p.Line > 0
+}
+
+// Span represents a range in the source from Start (inclusive) to End (exclusive)
+type Span struct {
+	Start Pos
+	End   Pos
+}
+
+// String returns the start position of the span
+func (s Span) String() string {
+	return s.Start.String()
+}
+
+// IsValid reports whether the span has been set
+func (s Span) IsValid() bool {
+	return s.Start.IsValid()
+}
+
+// Join returns the smallest span covering both spans
+func (s Span) Join(o Span) Span {
+	if !s.IsValid() {
+		return o
+	}
+	if !o.IsValid() {
+		return s
+	}
+	if o.Start.Offset < s.Start.Offset {
+		s.Start = o.Start
+	}
+	if o.End.Offset > s.End.Offset {
+		s.End = o.End
+	}
+	return s
+}
+
+// Excerpt returns the source line of the span start with the span underlined
+// by carets. Spans covering multiple lines are underlined to the end of the
+// first line.
+func (s Span) Excerpt(src string) string {
+	if !s.IsValid() || s.Start.Offset > len(src) {
+		return ""
+	}
+	begin := strings.LastIndexByte(src[:s.Start.Offset], '\n') + 1
+	end := strings.IndexByte(src[s.Start.Offset:], '\n')
+	if end < 0 {
+		end = len(src)
+	} else {
+		end += s.Start.Offset
+	}
+	line := strings.TrimRight(src[begin:end], "\r")
+
+	var b strings.Builder
+	for _, r := range strings.TrimRight(src[begin:s.Start.Offset], "\r") {
+		if r == '\t' {
+			b.WriteRune('\t')
+		} else {
+			b.WriteRune(' ')
+		}
+	}
+	width := 1
+	if s.End.Offset > s.Start.Offset {
+		stop := s.End.Offset
+		if stop > end {
+			stop = end
+		}
+		if n := utf8.RuneCountInString(src[s.Start.Offset:stop]); n > 1 {
+			width = n
+		}
+	}
+	b.WriteString(strings.Repeat("^", width))
+	return fmt.Sprintf("%s\n%s", line, b.String())
+}
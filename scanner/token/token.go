@@ -2,18 +2,22 @@
 
 package token
 
-// New returns a new token with given type and textual represenetation
-func New(kind Kind, repr string) *Token {
+// New returns a new token with given type, textual represenetation and span
+func New(kind Kind, repr string, span Span) *Token {
 	return &Token{
-		kind,
-		repr,
+		kind: kind,
+		repr: repr,
+		span: span,
 	}
 }
 
 // Token represents a token kind with its textual representation
 type Token struct {
-	kind Kind
-	repr string
+	kind     Kind
+	repr     string
+	span     Span
+	leading  []Trivia
+	trailing []Trivia
 }
 
 // String returns the textual representation of the token
@@ -26,6 +30,11 @@ func (t Token) Kind() Kind {
 	return t.kind
 }
 
+// Span returns the location of the token in the source
+func (t Token) Span() Span {
+	return t.span
+}
+
 // Kind reprensents a token from the parser
 type Kind int
 
@@ -36,6 +45,11 @@ const (
 	FLOAT_LITERAL
 	HEX_LITERAL
 	BIN_LITERAL
+	OCT_LITERAL
+	IMAG_LITERAL
+	IF
+	THEN
+	ELSE
 	PLUS
 	MINUS
 	MUL
@@ -45,8 +59,82 @@ const (
 	AND
 	OR
 	XOR
+	SHL
+	SHR
+	USHR
+	EQL
+	NEQ
+	LSS
+	LEQ
+	GTR
+	GEQ
+	LAND
+	LOR
+	NOT
+	TILDE
+	QUESTION
+	COLON
 	LPAR
 	RPAR
 	NEG
 	COMMA
+	ASSIGN
+	SEMICOLON
+	ROOT
+	SQUARE
+	CUBE
+	OPERATOR
+	NEWLINE
+	ILLEGAL
 )
+
+// IsSymbol reports whether tokens of the kind are operators or punctuation,
+// as opposed to identifiers, literals and keywords
+func (k Kind) IsSymbol() bool {
+	return k >= PLUS && k <= OPERATOR
+}
+
+// symbols maps the kinds of operators and punctuation to their canonical
+// symbol, which may differ from the text of a token if the scanner accepts
+// aliases, e.g. × for *
+var symbols = map[Kind]string{
+	PLUS:      "+",
+	MINUS:     "-",
+	MUL:       "*",
+	DIV:       "/",
+	POW:       "^",
+	MOD:       "%",
+	AND:       "&",
+	OR:        "|",
+	XOR:       "#",
+	SHL:       "<<",
+	SHR:       ">>",
+	USHR:      ">>>",
+	EQL:       "==",
+	NEQ:       "!=",
+	LSS:       "<",
+	LEQ:       "<=",
+	GTR:       ">",
+	GEQ:       ">=",
+	LAND:      "&&",
+	LOR:       "||",
+	NOT:       "!",
+	TILDE:     "~",
+	QUESTION:  "?",
+	COLON:     ":",
+	LPAR:      "(",
+	RPAR:      ")",
+	COMMA:     ",",
+	ASSIGN:    "=",
+	SEMICOLON: ";",
+	ROOT:      "√",
+	SQUARE:    "²",
+	CUBE:      "³",
+}
+
+// Symbol returns the canonical symbol of tokens of the kind, or an empty
+// string if the kind has no fixed symbol, as for identifiers, literals and
+// OPERATOR tokens
+func (k Kind) Symbol() string {
+	return symbols[k]
+}
@@ -0,0 +1,54 @@
+package token
+
+// TriviaKind classifies trivia
+type TriviaKind int
+
+const (
+	// LineComment is a comment from // to the end of the line
+	LineComment TriviaKind = iota
+	// BlockComment is a comment enclosed in /* and */, which may be nested
+	BlockComment
+	// BlankLine is a line consisting of whitespace only
+	BlankLine
+)
+
+// String returns the name of the trivia kind
+func (k TriviaKind) String() string {
+	switch k {
+	case LineComment:
+		return "LINE_COMMENT"
+	case BlockComment:
+		return "BLOCK_COMMENT"
+	default:
+		return "BLANK_LINE"
+	}
+}
+
+// Trivia is source text without meaning to the parser, such as comments and
+// blank lines. The text of a comment includes its delimiters.
+type Trivia struct {
+	Kind TriviaKind
+	Text string
+	Span Span
+}
+
+// Leading returns the trivia preceding the token on the lines before it
+func (t Token) Leading() []Trivia {
+	return t.leading
+}
+
+// Trailing returns the comments following the token on the same line. They
+// are attached once the next token has been scanned.
+func (t Token) Trailing() []Trivia {
+	return t.trailing
+}
+
+// AddLeading attaches trivia preceding the token
+func (t *Token) AddLeading(tr ...Trivia) {
+	t.leading = append(t.leading, tr...)
+}
+
+// AddTrailing attaches trivia following the token
+func (t *Token) AddTrailing(tr ...Trivia) {
+	t.trailing = append(t.trailing, tr...)
+}